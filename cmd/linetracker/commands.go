@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/reww406/linetracker/internal/history"
+	"github.com/reww406/linetracker/internal/job"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/station"
+	"github.com/reww406/linetracker/internal/store"
+	"github.com/reww406/linetracker/internal/train"
+)
+
+// newFlagSet parses a command's own flags, help goes to stderr with the
+// logs so stdout only carries the command's output.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+func runMigrate(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("migrate")
+	status := fs.Bool("status", false, "list applied and pending migrations")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	migrator := store.NewMigrator(a.ddb, a.config, a.log)
+	if !*status {
+		applied, err := migrator.Migrate(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range applied {
+			fmt.Fprintf(a.out, "applied %d %s\n", migration.Version, migration.Description)
+		}
+		fmt.Fprintf(a.out, "%d migrations applied\n", len(applied))
+		return nil
+	}
+
+	applied, err := migrator.Applied(ctx)
+	if err != nil {
+		return err
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tAPPLIED")
+	for _, migration := range applied {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Description,
+			migration.AppliedAt.Format(time.RFC3339))
+	}
+	for _, migration := range pending {
+		fmt.Fprintf(w, "%d\t%s\tpending\n", migration.Version, migration.Description)
+	}
+	return w.Flush()
+}
+
+func runSeed(ctx context.Context, a *app, args []string) error {
+	if err := newFlagSet("seed").Parse(args); err != nil {
+		return err
+	}
+	repo := station.NewRepository(a.ddb, a.config, a.log)
+	ingester := station.NewIngester(a.config, a.metro, repo, a.log)
+	if err := ingester.InsertStations(ctx); err != nil {
+		return err
+	}
+	stations, err := repo.ListStations(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.out, "%d stations stored\n", len(stations))
+	return nil
+}
+
+func runPollOnce(ctx context.Context, a *app, args []string) error {
+	if err := newFlagSet("poll-once").Parse(args); err != nil {
+		return err
+	}
+	trains := train.NewRepository(a.ddb, a.config, a.log, a.metrics)
+	bus := train.NewEventBus()
+	bus.Subscribe(trains.StoreSnapshot)
+	bus.Subscribe(history.NewRepository(a.ddb, a.config, a.log).ArchiveSnapshot)
+	stored := 0
+	bus.Subscribe(func(_ context.Context, event train.PredictionSnapshot) error {
+		stored = len(event.Trains())
+		return nil
+	})
+
+	poller := train.NewPoller(
+		a.config, a.metro, bus, job.NewTracker(), a.log, a.metrics, a.tp,
+	)
+	if err := poller.PollOnce(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.out, "%d predictions stored\n", stored)
+	return nil
+}
+
+func runTrains(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("trains")
+	location := fs.String("location", "", "station code, for example K08 (required)")
+	line := fs.String("line", "", "only trains on this line, for example OR")
+	direction := fs.String("direction", "", "only trains headed to this destination")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *location == "" {
+		fs.Usage()
+		return fmt.Errorf("-location is required")
+	}
+
+	trains, err := train.NewRepository(a.ddb, a.config, a.log, a.metrics).
+		GetTrainPredictions(ctx, train.GetNextTrainsRequest{
+			LineCode:     metro.LineCode(*line),
+			LocationCode: *location,
+			Direction:    *direction,
+		})
+	if err != nil {
+		return err
+	}
+	return printTrains(a.out, trains)
+}
+
+func printTrains(out io.Writer, trains []train.TrainModel) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "OBSERVED\tLINE\tDESTINATION\tMIN\tCARS\tGROUP")
+	for _, t := range trains {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n",
+			time.UnixMilli(t.CreatedEpochMs).Format(time.TimeOnly),
+			t.LineCode, t.Destination, t.Minutes, t.CarCount, t.Group,
+		)
+	}
+	return w.Flush()
+}
+
+func runStations(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("stations")
+	line := fs.String("line", "", "only stations on this line, for example RD")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	repo := station.NewRepository(a.ddb, a.config, a.log)
+	request := station.ListStationsRequest{
+		LineCode: metro.LineCode(*line),
+		Sort:     "code",
+		Limit:    station.MaxPageLimit,
+	}
+	var stations []station.StationModel
+	for {
+		page, err := repo.ListStationsPage(ctx, request)
+		if err != nil {
+			return err
+		}
+		stations = append(stations, page.Stations...)
+		if page.NextCursor == "" {
+			break
+		}
+		request.Cursor = page.NextCursor
+	}
+	return printStations(a.out, stations)
+}
+
+func printStations(out io.Writer, stations []station.StationModel) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CODE\tNAME\tLINES")
+	for _, s := range stations {
+		lines := make([]string, len(s.LineCodes))
+		for i, line := range s.LineCodes {
+			lines[i] = string(line)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Code, s.Name, strings.Join(lines, ","))
+	}
+	return w.Flush()
+}
+
+func runDump(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("dump")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tables := map[string]*string{
+		"stations":   a.config.StationTableName(),
+		"trains":     a.config.PredictionTableName(),
+		"migrations": a.config.MigrationTableName(),
+		"history":    a.config.HistoryTableName(),
+	}
+	tableName, ok := tables[fs.Arg(0)]
+	if fs.NArg() != 1 || !ok {
+		return fmt.Errorf("dump takes one of stations, trains, history or migrations")
+	}
+
+	encoder := json.NewEncoder(a.out)
+	return store.DumpTable(ctx, a.ddb, tableName, func(item map[string]any) error {
+		return encoder.Encode(item)
+	})
+}
@@ -0,0 +1,152 @@
+// Command linetracker runs one-off operator tasks against the same store and
+// WMATA API the server uses.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/metrics"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/store"
+	"github.com/reww406/linetracker/internal/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// app is what every command runs against.
+type app struct {
+	config  *config.Configuration
+	log     *logrus.Logger
+	ddb     *dynamodb.Client
+	metro   *metro.Client
+	metrics *metrics.Metrics
+	tp      trace.TracerProvider
+	out     io.Writer
+}
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, a *app, args []string) error
+}
+
+var commands = []command{
+	{"migrate", "apply pending schema migrations, -status lists them", runMigrate},
+	{"seed", "fetch stations from WMATA and write them to the store", runSeed},
+	{"poll-once", "poll WMATA for predictions once and store them", runPollOnce},
+	{"trains", "print stored predictions for a station", runTrains},
+	{"stations", "print stored stations", runStations},
+	{"dump", "print every item of stations, trains, history or migrations as JSON lines", runDump},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: linetracker [config flags] <command> [command flags]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nconfig flags are the server's, see linetracker -h.")
+}
+
+// splitArgs separates the config flags in front of the command from the
+// command's own flags. The command is nil when the config flags do not parse
+// or are not followed by a known command.
+func splitArgs(args []string) (configArgs []string, cmd *command, cmdArgs []string) {
+	configArgs, rest, err := config.SplitArgs(args)
+	if err != nil || len(rest) == 0 {
+		return args, nil, nil
+	}
+	for j := range commands {
+		if commands[j].name == rest[0] {
+			return configArgs, &commands[j], rest[1:]
+		}
+	}
+	return args, nil, nil
+}
+
+func isHelp(args []string) bool {
+	for _, arg := range args {
+		if arg == "-h" || arg == "-help" || arg == "--help" {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	configArgs, cmd, cmdArgs := splitArgs(os.Args[1:])
+	if cmd == nil && !isHelp(configArgs) {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	appConfig, err := config.Load(configArgs, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		usage(os.Stderr)
+		return
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to load config.")
+	}
+
+	// Command output goes to stdout, keep logs out of it.
+	for i, output := range appConfig.LogOutputs {
+		if output == "stdout" {
+			appConfig.LogOutputs[i] = "stderr"
+		}
+	}
+	log := config.NewLogger(appConfig)
+
+	ctx, stop := signal.NotifyContext(
+		context.Background(), os.Interrupt, syscall.SIGTERM,
+	)
+	defer stop()
+
+	tp, shutdownTracing, err := tracing.NewProvider(ctx, appConfig)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to set up tracing.")
+	}
+
+	m := metrics.New()
+	ddbClient, err := store.NewClient(ctx, appConfig, m, tp)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to connect to DDB.")
+	}
+
+	err = cmd.run(ctx, &app{
+		config:  appConfig,
+		log:     log,
+		ddb:     ddbClient,
+		metro:   metro.NewClient(appConfig, log, m, tp),
+		metrics: m,
+		tp:      tp,
+		out:     os.Stdout,
+	}, cmdArgs)
+	if flushErr := shutdownTracing(context.Background()); flushErr != nil {
+		log.WithError(flushErr).Error("failed to flush traces.")
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"command": cmd.name,
+			"error":   err,
+		}).Fatal("command failed.")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/station"
+	"github.com/reww406/linetracker/internal/train"
+)
+
+func TestSplitArgsSeparatesConfigFromCommandFlags(t *testing.T) {
+	configArgs, cmd, cmdArgs := splitArgs([]string{
+		"-config", "prod.json", "trains", "-location", "K08",
+	})
+	if cmd == nil || cmd.name != "trains" {
+		t.Fatalf("expected the trains command, got %+v", cmd)
+	}
+	if strings.Join(configArgs, " ") != "-config prod.json" ||
+		strings.Join(cmdArgs, " ") != "-location K08" {
+		t.Errorf("unexpected split %q %q", configArgs, cmdArgs)
+	}
+
+	if _, cmd, _ := splitArgs([]string{"-config", "prod.json"}); cmd != nil {
+		t.Errorf("expected no command, got %s", cmd.name)
+	}
+}
+
+func TestSplitArgsSkipsFlagValuesNamedLikeCommands(t *testing.T) {
+	configArgs, cmd, cmdArgs := splitArgs([]string{
+		"-station-table", "stations", "-prod", "seed", "-dry",
+	})
+	if cmd == nil || cmd.name != "seed" {
+		t.Fatalf("expected the seed command, got %+v", cmd)
+	}
+	if strings.Join(configArgs, " ") != "-station-table stations -prod" ||
+		strings.Join(cmdArgs, " ") != "-dry" {
+		t.Errorf("unexpected split %q %q", configArgs, cmdArgs)
+	}
+
+	if _, cmd, _ := splitArgs([]string{"-station-table", "stations"}); cmd != nil {
+		t.Errorf("expected no command, got %s", cmd.name)
+	}
+	if _, cmd, _ := splitArgs([]string{"-unknown", "seed"}); cmd != nil {
+		t.Errorf("expected no command after an unknown flag, got %s", cmd.name)
+	}
+}
+
+func TestPrintTrainsAndStations(t *testing.T) {
+	var out bytes.Buffer
+	observed := time.Date(2024, 6, 1, 8, 30, 0, 0, time.Local)
+	err := printTrains(&out, []train.TrainModel{{
+		LineCode: "OR", Destination: "NewCarr", Minutes: 3, CarCount: 8,
+		Group: "1", CreatedEpochMs: observed.UnixMilli(),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || strings.Join(strings.Fields(lines[1]), " ") !=
+		"08:30:00 OR NewCarr 3 8 1" {
+		t.Errorf("unexpected trains output:\n%s", out.String())
+	}
+
+	out.Reset()
+	err = printStations(&out, []station.StationModel{{
+		Code: "E10", Name: "Greenbelt",
+		LineCodes: []metro.LineCode{metro.GreenLine, metro.YellowLine},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "E10   Greenbelt  GR,YL") {
+		t.Errorf("unexpected stations output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/job"
+	"github.com/reww406/linetracker/internal/station"
+	"github.com/reww406/linetracker/internal/train"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requireAdminToken rejects any request that does not carry the configured
+// admin token as a bearer token.
+func requireAdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			abortWithError(c, apperror.New(
+				apperror.CodeUnauthenticated, "unauthorized", nil,
+			))
+			return
+		}
+		c.Next()
+	}
+}
+
+// startJob runs fn in the background, the request context is not used since
+// it is cancelled as soon as the response is written but its request ID and
+// span are kept so the job's logs and spans can be traced back to the
+// request.
+func (s *Server) startJob(c *gin.Context, name string, fn job.Func) {
+	ctx := config.ContextWithRequestID(
+		context.Background(), config.RequestIDFromContext(c),
+	)
+	ctx = trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(c))
+	err := s.jobs.Start(ctx, name, fn)
+	switch {
+	case errors.Is(err, job.ErrAlreadyRunning):
+		abortWithError(c, apperror.New(
+			apperror.CodeConflict, fmt.Sprintf("job %s is already running", name), err,
+		))
+	case errors.Is(err, job.ErrShuttingDown):
+		abortWithError(c, apperror.New(
+			apperror.CodeUnavailable, "server is shutting down", err,
+		))
+	default:
+		c.JSON(http.StatusAccepted, gin.H{
+			"status": "started",
+			"job":    name,
+		})
+	}
+}
+
+func (s *Server) ingestStations(c *gin.Context) {
+	s.startJob(c, station.IngestJobName, s.ingester.InsertStations)
+}
+
+func (s *Server) pollTrains(c *gin.Context) {
+	s.startJob(c, train.PollJobName, s.poller.PollOnce)
+}
+
+func (s *Server) getJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"jobs": s.jobs.Statuses(),
+	})
+}
+
+func (s *Server) setupAdminRoutes(token string) {
+	if token == "" {
+		s.log.Warn("admin_token is not configured, admin routes are disabled.")
+		return
+	}
+
+	admin := s.router.Group("/admin", requireAdminToken(token))
+	{
+		// admin/ingest/stations
+		admin.POST("/ingest/stations", s.ingestStations)
+
+		// admin/poll/trains
+		admin.POST("/poll/trains", s.pollTrains)
+
+		// admin/jobs
+		admin.GET("/jobs", s.getJobs)
+	}
+}
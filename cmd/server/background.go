@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/reww406/linetracker/internal/job"
+	"github.com/reww406/linetracker/internal/station"
+)
+
+// startBackground runs fn on a goroutine that Run waits for on shutdown, fn
+// must return once ctx is done.
+func (s *Server) startBackground(ctx context.Context, fn func(context.Context)) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn(ctx)
+	}()
+}
+
+// waitBackground waits for every loop started with startBackground, giving
+// up once ctx is done.
+func (s *Server) waitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refreshStations re-ingests stations every interval until ctx is done so
+// schedule changes are picked up without a restart.
+func (s *Server) refreshStations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.log.Info("stopping station refresh.")
+			return
+		case <-ticker.C:
+		}
+
+		err := s.jobs.Run(
+			context.WithoutCancel(ctx), station.IngestJobName, s.ingester.InsertStations,
+		)
+		if err != nil && !errors.Is(err, job.ErrShuttingDown) {
+			s.log.WithError(err).Error("failed to refresh stations.")
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitBackground(t *testing.T) {
+	s := &Server{}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.startBackground(ctx, func(ctx context.Context) { <-ctx.Done() })
+	cancel()
+	if err := s.waitBackground(context.Background()); err != nil {
+		t.Errorf("expected the loop to stop, got %v", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	s.startBackground(context.Background(), func(context.Context) { <-release })
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer waitCancel()
+	if err := s.waitBackground(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to time out, got %v", err)
+	}
+}
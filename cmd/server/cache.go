@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Station data only changes when it is re-ingested.
+	stationsMaxAge = 5 * time.Minute
+	linesMaxAge    = 24 * time.Hour
+)
+
+// etagMatches reports whether the If-None-Match header lists etag.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedJSON writes body with an ETag of its content and lets clients cache
+// it for maxAge, answering 304 when the client already has this version.
+func (s *Server) cachedJSON(c *gin.Context, maxAge time.Duration, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		abortWithError(c, fmt.Errorf("failed to marshal response: %w", err))
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	scope := "public"
+	if s.privateCache {
+		scope = "private"
+	}
+	c.Header("Cache-Control", fmt.Sprintf(
+		"%s, max-age=%d", scope, int(maxAge.Seconds()),
+	))
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
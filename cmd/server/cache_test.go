@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCachedJSONHonoursIfNoneMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{log: logrus.New()}
+	router := gin.New()
+	router.GET("/api/v1/lines", s.getLines)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/lines", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d %q", rec.Code, etag)
+	}
+	if rec.Header().Get("Cache-Control") != "public, max-age=86400" {
+		t.Errorf("unexpected Cache-Control %q", rec.Header().Get("Cache-Control"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/lines", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("expected empty 304, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCachedJSONIsPrivateWithAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{log: logrus.New(), privateCache: true}
+	router := gin.New()
+	router.GET("/api/v1/lines", s.getLines)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/lines", nil))
+	if rec.Header().Get("Cache-Control") != "private, max-age=86400" {
+		t.Errorf("unexpected Cache-Control %q", rec.Header().Get("Cache-Control"))
+	}
+}
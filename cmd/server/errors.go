@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/apperror"
+)
+
+type errorResponse struct {
+	Code      apperror.Code `json:"code"`
+	Message   string        `json:"message"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+func httpStatus(code apperror.Code) int {
+	switch code {
+	case apperror.CodeInvalidArgument:
+		return http.StatusBadRequest
+	case apperror.CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case apperror.CodeNotFound:
+		return http.StatusNotFound
+	case apperror.CodeConflict:
+		return http.StatusConflict
+	case apperror.CodeRateLimited:
+		return http.StatusTooManyRequests
+	case apperror.CodeUpstreamUnavailable:
+		return http.StatusBadGateway
+	case apperror.CodeStoreFailure, apperror.CodeUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// abortWithError responds with the status and client safe message for err's
+// code. The full error is attached to the context so the access log records
+// the cause next to the request ID.
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	code := apperror.CodeOf(err)
+	c.AbortWithStatusJSON(httpStatus(code), errorResponse{
+		Code:      code,
+		Message:   apperror.MessageOf(err),
+		RequestID: config.RequestIDFromContext(c),
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAbortWithErrorWritesCodeMessageAndRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		err     error
+		status  int
+		code    apperror.Code
+		message string
+	}{
+		{
+			err:     apperror.InvalidArgument("limit must be between 1 and 500"),
+			status:  http.StatusBadRequest,
+			code:    apperror.CodeInvalidArgument,
+			message: "limit must be between 1 and 500",
+		},
+		{
+			err:     apperror.Upstream("WMATA API is unavailable", errors.New("timeout")),
+			status:  http.StatusBadGateway,
+			code:    apperror.CodeUpstreamUnavailable,
+			message: "WMATA API is unavailable",
+		},
+		{
+			err:     errors.New("secret table name"),
+			status:  http.StatusInternalServerError,
+			code:    apperror.CodeInternal,
+			message: "internal error",
+		},
+	}
+	for _, tc := range cases {
+		log := logrus.New()
+		log.SetOutput(io.Discard)
+		router := gin.New()
+		router.ContextWithFallback = true
+		router.Use(requestID(), accessLog(log))
+		router.GET("/", func(c *gin.Context) { abortWithError(c, tc.err) })
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestIDHeader, "req-1")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		var body errorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode body %q: %v", rec.Body.String(), err)
+		}
+		if rec.Code != tc.status || body.Code != tc.code ||
+			body.Message != tc.message || body.RequestID != "req-1" {
+			t.Errorf("%v: got %d %+v", tc.err, rec.Code, body)
+		}
+	}
+}
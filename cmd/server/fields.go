@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/reww406/linetracker/internal/api"
+	"github.com/reww406/linetracker/internal/apperror"
+)
+
+// jsonFieldNames lists the JSON keys t's fields are encoded as.
+func jsonFieldNames(t reflect.Type) map[string]string {
+	names := make(map[string]string, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[strings.ToLower(name)] = name
+	}
+	return names
+}
+
+// selectFields trims every item to the comma separated fields, matched
+// against the JSON keys case-insensitively.
+func selectFields[T any](
+	items []T, fields string,
+) ([]map[string]json.RawMessage, error) {
+	known := jsonFieldNames(reflect.TypeOf((*T)(nil)).Elem())
+	var keep []string
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, ok := known[strings.ToLower(field)]
+		if !ok {
+			return nil, apperror.InvalidArgument(
+				fmt.Sprintf("unknown field %q", field),
+			)
+		}
+		keep = append(keep, name)
+	}
+
+	result := make([]map[string]json.RawMessage, len(items))
+	for i, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode item: %w", err)
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, fmt.Errorf("failed to decode item: %w", err)
+		}
+		result[i] = make(map[string]json.RawMessage, len(keep))
+		for _, name := range keep {
+			if value, ok := all[name]; ok {
+				result[i][name] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+// listResponse wraps items in the list envelope, trimmed to fields when any
+// are requested.
+func listResponse[T any](items []T, fields string, nextCursor string) (
+	any, error,
+) {
+	if strings.TrimSpace(fields) == "" {
+		return api.NewListResponse(items, nextCursor), nil
+	}
+	selected, err := selectFields(items, fields)
+	if err != nil {
+		return nil, err
+	}
+	return api.NewListResponse(selected, nextCursor), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type fieldsItem struct {
+	Code     string `json:"code"`
+	Name     string
+	Schedule []string `json:"schedule"`
+}
+
+func TestSelectFields(t *testing.T) {
+	items := []fieldsItem{{Code: "A01", Name: "Metro Center", Schedule: []string{"x"}}}
+
+	selected, err := selectFields(items, "CODE, name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(selected)
+	if string(data) != `[{"Name":"Metro Center","code":"A01"}]` {
+		t.Errorf("unexpected selection %s", data)
+	}
+
+	if _, err := selectFields(items, "code,zip"); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestListResponseWithoutFields(t *testing.T) {
+	items := []fieldsItem{{Code: "A01"}}
+	body, err := listResponse(items, "", "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(body)
+	want := `{"data":[{"code":"A01","Name":"","schedule":null}],` +
+		`"meta":{"count":1,"next_cursor":"next"}}`
+	if string(data) != want {
+		t.Errorf("expected %s, got %s", want, data)
+	}
+}
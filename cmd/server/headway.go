@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/internal/api"
+	"github.com/reww406/linetracker/internal/headway"
+	"github.com/reww406/linetracker/internal/metro"
+)
+
+func (s *Server) getHeadways(c *gin.Context) {
+	from, err := parseTime(c, "from")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	to, err := parseTime(c, "to")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	result, err := s.headways.GetHeadways(c, headway.Request{
+		LocationCode: c.Query("location_code"),
+		LineCode:     metro.LineCode(c.Query("line_code")),
+		From:         from,
+		To:           to,
+	})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.NewListResponse(api.NewHeadways(result), ""))
+}
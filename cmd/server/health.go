@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/health"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/store"
+)
+
+// How long a readiness report is reused, /health/ready is unauthenticated
+// and each check reads DDB.
+const readyCacheFor = 5 * time.Second
+
+// freshness fails when last is older than maxAge. Nothing having happened
+// yet is only a failure once the poller has been running for maxAge.
+func freshness(
+	last time.Time, ok bool, since time.Time, maxAge time.Duration, what string,
+) health.Result {
+	if !ok {
+		if time.Since(since) < maxAge {
+			return health.OK("waiting for first " + what)
+		}
+		return health.Fail(fmt.Errorf("no %s in %s", what, maxAge))
+	}
+	age := time.Since(last).Round(time.Second)
+	if age > maxAge {
+		return health.Fail(fmt.Errorf("last %s was %s ago", what, age))
+	}
+	return health.OK(fmt.Sprintf("last %s %s ago", what, age))
+}
+
+func (s *Server) registerHealthChecks(
+	appConfig *config.Configuration,
+	ddbClient *dynamodb.Client,
+	metroClient *metro.Client,
+) {
+	maxAge := appConfig.HealthMaxAge
+
+	// AWS errors are logged rather than returned to unauthenticated callers.
+	s.health.Register("store", func(ctx context.Context) health.Result {
+		if err := store.Ping(ctx, ddbClient, appConfig); err != nil {
+			s.log.WithContext(ctx).WithError(err).Warn("store check failed.")
+			return health.Fail(errors.New("tables are unavailable"))
+		}
+		return health.OK("")
+	})
+
+	s.health.Register("stations", func(ctx context.Context) health.Result {
+		populated, err := s.stations.HasStations(ctx)
+		if err != nil {
+			s.log.WithContext(ctx).WithError(err).Warn("stations check failed.")
+			return health.Fail(errors.New("failed to read stations table"))
+		}
+		if !populated {
+			return health.Fail(errors.New("stations table is empty"))
+		}
+		return health.OK("")
+	})
+
+	// WMATA is only called regularly while the poller runs.
+	s.health.Register("wmata", func(ctx context.Context) health.Result {
+		since, running := s.poller.RunningSince()
+		if !running {
+			return health.Disabled("poller is not running")
+		}
+		last, ok := metroClient.LastSuccess()
+		return freshness(last, ok, since, maxAge, "successful WMATA call")
+	})
+
+	s.health.Register("poller", func(ctx context.Context) health.Result {
+		since, running := s.poller.RunningSince()
+		if !running {
+			return health.Disabled("poller is not running")
+		}
+		last, ok := s.trains.LastStored()
+		return freshness(last, ok, since, maxAge, "stored snapshot")
+	})
+}
+
+// live only reports that the process is serving requests.
+func (s *Server) live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// ready reports every dependency and returns 503 when any of them fail.
+func (s *Server) ready(c *gin.Context) {
+	report := s.health.Check(c)
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+		s.log.WithContext(c).WithField("components", report.Components).Warn(
+			"service is not ready.",
+		)
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/internal/api"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/history"
+)
+
+// parseTime reads an optional RFC 3339 query parameter.
+func parseTime(c *gin.Context, name string) (time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, apperror.InvalidArgument(fmt.Sprintf(
+			"%s must be an RFC 3339 time", name,
+		))
+	}
+	return t, nil
+}
+
+func (s *Server) getTrainHistory(c *gin.Context) {
+	from, err := parseTime(c, "from")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	to, err := parseTime(c, "to")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	req := history.Request{
+		LocationCode: c.Query("location_code"),
+		From:         from,
+		To:           to,
+		Sample:       c.Query("sample"),
+		Cursor:       c.Query("cursor"),
+	}
+	if raw := c.Query("interval"); raw != "" {
+		req.Interval, err = time.ParseDuration(raw)
+		if err != nil {
+			abortWithError(c, apperror.InvalidArgument(
+				"interval must be a duration such as 30s or 5m",
+			))
+			return
+		}
+	}
+	if raw := c.Query("limit"); raw != "" {
+		req.Limit, err = strconv.Atoi(raw)
+		if err != nil || req.Limit < 1 {
+			abortWithError(c, apperror.InvalidArgument(fmt.Sprintf(
+				"limit must be between 1 and %d", history.MaxLimit,
+			)))
+			return
+		}
+	}
+
+	page, err := s.history.GetSnapshots(c, req)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.NewListResponse(
+		api.NewSnapshots(page.Snapshots), page.NextCursor,
+	))
+}
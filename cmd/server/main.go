@@ -1,27 +1,66 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
-	"time"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/api"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/headway"
+	"github.com/reww406/linetracker/internal/health"
+	"github.com/reww406/linetracker/internal/history"
+	"github.com/reww406/linetracker/internal/job"
+	"github.com/reww406/linetracker/internal/metrics"
 	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/ratelimit"
 	"github.com/reww406/linetracker/internal/station"
 	"github.com/reww406/linetracker/internal/store"
+	"github.com/reww406/linetracker/internal/tracing"
+	"github.com/reww406/linetracker/internal/tracker"
 	"github.com/reww406/linetracker/internal/train"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Server struct {
-	router *gin.Engine
+	router   *gin.Engine
+	log      *logrus.Logger
+	jobs     *job.Tracker
+	feed     *train.Feed
+	bus      *train.EventBus
+	trains   *train.Repository
+	history  *history.Repository
+	headways *headway.Service
+	tracker  *tracker.Tracker
+	poller   *train.Poller
+	stations *station.Repository
+	ingester *station.Ingester
+	metrics  *metrics.Metrics
+	health   *health.Checker
+	upgrader *websocket.Upgrader
+	// Closed once shutdown starts so long lived streams end.
+	shutdown chan struct{}
+	// The poller and station refresh loops started by Run.
+	background sync.WaitGroup
+	// Cached responses are private to the client when API keys are required
+	// so shared caches do not serve them to callers without a key.
+	privateCache bool
 }
 
-var ddbClient *dynamodb.Client
-
 func (s *Server) getNextTrains(c *gin.Context) {
 	// Get query parameters
 	lineCode := c.Query("line_code")
@@ -34,73 +73,183 @@ func (s *Server) getNextTrains(c *gin.Context) {
 		Direction:    direction,
 	}
 
-	result, err := train.GetTrainPredictions(c, ddbClient, req)
+	result, err := s.trains.GetTrainPredictions(c, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to get trains",
-		})
+		abortWithError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"trains": result,
+	c.JSON(http.StatusOK, api.NewListResponse(api.NewTrains(result), ""))
+}
+
+func (s *Server) getCurrentTrains(c *gin.Context) {
+	result, err := s.trains.GetCurrentTrains(c, train.CurrentTrainsRequest{
+		LineCode:        metro.LineCode(c.Query("line_code")),
+		DestinationCode: c.Query("destination_code"),
 	})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.NewListResponse(api.NewTrains(result), ""))
 }
 
 func (s *Server) getStations(c *gin.Context) {
-	stationList, err := station.ListStations(c, ddbClient)
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > station.MaxPageLimit {
+			abortWithError(c, apperror.InvalidArgument(fmt.Sprintf(
+				"limit must be between 1 and %d", station.MaxPageLimit,
+			)))
+			return
+		}
+		limit = parsed
+	}
+
+	page, err := s.stations.ListStationsPage(c, station.ListStationsRequest{
+		LineCode: metro.LineCode(c.Query("line_code")),
+		Sort:     c.Query("sort"),
+		Limit:    limit,
+		Cursor:   c.Query("cursor"),
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to get stations",
-		})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"stations": stationList,
-	})
+
+	body, err := listResponse(
+		api.NewStations(page.Stations), c.Query("fields"), page.NextCursor,
+	)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	s.cachedJSON(c, stationsMaxAge, body)
 }
 
 func (s *Server) getLines(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"lines": []string{
-			"Silver",
-			"Orange",
-			"Blue",
-			"Red",
-			"Green",
-			"Yellow",
-		},
-	})
+	s.cachedJSON(c, linesMaxAge, api.NewListResponse(api.Lines(), ""))
 }
 
-func (s *Server) getDestinations(c *gin.Context) {
-	destinationList, err := station.GetDestinationStations(c, ddbClient)
+func (s *Server) getPositions(c *gin.Context) {
+	positions, err := s.tracker.Positions(metro.LineCode(c.Param("code")))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to get stations",
-		})
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"destinations": destinationList,
-	})
+
+	c.JSON(http.StatusOK, api.NewListResponse(api.NewPositions(positions), ""))
 }
 
-func (s *Server) Run(addr string) error {
-	return s.router.Run(addr)
+func (s *Server) getDestinations(c *gin.Context) {
+	destinations, err := s.stations.GetDestinationStations(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	body, err := listResponse(
+		api.NewStations(destinations), c.Query("fields"), "",
+	)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	s.cachedJSON(c, stationsMaxAge, body)
 }
 
-func (s *Server) setupRoutes() {
-	// Health check
-	s.router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+// Run serves, polls WMATA and refreshes stations until ctx is done, then
+// drains in-flight requests, waits for background jobs and stops the polling
+// loops, giving all of them appConfig.ShutdownTimeout to finish.
+func (s *Server) Run(
+	ctx context.Context, appConfig *config.Configuration,
+) error {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", appConfig.BindingPort),
+		Handler:      s.router,
+		ReadTimeout:  appConfig.ReadTimeout,
+		WriteTimeout: appConfig.WriteTimeout,
+		IdleTimeout:  appConfig.IdleTimeout,
+	}
+	// Streams never finish on their own, tell them to end so Shutdown does
+	// not wait on them until the deadline.
+	srv.RegisterOnShutdown(func() {
+		close(s.shutdown)
 	})
 
-	// API routes group
-	v1 := s.router.Group("/api/v1")
+	serveErr := make(chan error, 1)
+	go func() {
+		s.log.WithField("addr", srv.Addr).Info("starting server.")
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	s.startBackground(ctx, s.poller.PollTrainPredictions)
+	if appConfig.StationRefresh > 0 {
+		s.startBackground(ctx, func(ctx context.Context) {
+			s.refreshStations(ctx, appConfig.StationRefresh)
+		})
+	}
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to start server: %w", err)
+	case <-ctx.Done():
+	}
+
+	s.log.Info("shutting down server.")
+	shutdownCtx, cancel := context.WithTimeout(
+		context.Background(), appConfig.ShutdownTimeout,
+	)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain requests: %w", err))
+	}
+	if err := s.jobs.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to finish jobs: %w", err))
+	}
+	if err := s.waitBackground(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to stop background loops: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) setupRoutes(
+	appConfig *config.Configuration, validate gin.HandlerFunc,
+) {
+	// Health check, /health is kept for existing callers and matches live.
+	s.router.GET("/health", s.live)
+	s.router.GET("/health/live", s.live)
+	s.router.GET("/health/ready", s.ready)
+
+	s.router.GET("/metrics", gin.WrapH(s.metrics.Handler()))
+
+	// Docs are public so they are registered outside the v1 group.
+	s.router.GET("/api/v1/openapi.json", s.getOpenAPI)
+	s.router.GET("/api/v1/docs", s.getDocs)
+
+	s.privateCache = len(appConfig.APIKeys) > 0
+
+	// API routes group, IPs are limited before the key is checked so keys
+	// cannot be guessed at full speed.
+	v1 := s.router.Group(
+		"/api/v1",
+		rateLimit(
+			ratelimit.New(appConfig.RateLimitIPRPS, appConfig.RateLimitIPBurst),
+			clientIP,
+		),
+		requireAPIKey(appConfig.APIKeys),
+		rateLimit(
+			ratelimit.New(appConfig.RateLimitKeyRPS, appConfig.RateLimitKeyBurst),
+			apiKey,
+		),
+		validate,
+	)
 	{
 		// Routes
-		// api/v1/stations
+		// api/v1/stations?line_code=RD&sort=name&limit=20&cursor=...&fields=code,name
 		v1.GET("/stations", func(c *gin.Context) {
 			s.getStations(c)
 		})
@@ -115,60 +264,203 @@ func (s *Server) setupRoutes() {
 			s.getNextTrains(c)
 		})
 
+		// api/v1/trains/current?line_code=OR&destination_code=D13
+		v1.GET("/trains/current", func(c *gin.Context) {
+			s.getCurrentTrains(c)
+		})
+
+		// api/v1/trains/stream?location_code=K08&line_code=OR
+		v1.GET("/trains/stream", func(c *gin.Context) {
+			s.streamTrains(c)
+		})
+
+		// api/v1/trains/ws
+		v1.GET("/trains/ws", func(c *gin.Context) {
+			s.websocketTrains(c)
+		})
+
+		// api/v1/history/trains?location_code=K08&from=2024-05-01T08:00:00Z&interval=5m
+		v1.GET("/history/trains", func(c *gin.Context) {
+			s.getTrainHistory(c)
+		})
+
+		// api/v1/analytics/headways?location_code=K08&line_code=OR&from=2024-05-01T07:00:00Z
+		v1.GET("/analytics/headways", func(c *gin.Context) {
+			s.getHeadways(c)
+		})
+
 		// api/v1/lines
 		v1.GET("/lines", func(c *gin.Context) {
 			s.getLines(c)
 		})
+
+		// api/v1/lines/OR/positions
+		v1.GET("/lines/:code/positions", func(c *gin.Context) {
+			s.getPositions(c)
+		})
 	}
+
+	s.setupAdminRoutes(appConfig.AdminToken)
 }
 
-func CreateGinServer() *Server {
+func CreateGinServer(
+	appConfig *config.Configuration,
+	log *logrus.Logger,
+	ddbClient *dynamodb.Client,
+	m *metrics.Metrics,
+	tp trace.TracerProvider,
+) (*Server, error) {
+	spec, err := api.LoadSpec(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	validate, err := validateRequests(spec)
+	if err != nil {
+		return nil, err
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	// Lets handlers pass the gin.Context as a context.Context and keep the
+	// request ID set on the request's context.
+	router.ContextWithFallback = true
+	if err := router.SetTrustedProxies(appConfig.TrustedProxies); err != nil {
+		// Already checked by config validation.
+		log.WithError(err).Error("failed to set trusted proxies.")
+	}
 
 	// Middleware
 	router.Use(gin.Recovery())
-	router.Use(cors.Default())
-	router.Use(
-		gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-			return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
-				param.ClientIP,
-				param.TimeStamp.Format(time.RFC1123),
-				param.Method,
-				param.Path,
-				param.Request.Proto,
-				param.StatusCode,
-				param.Latency,
-				param.Request.UserAgent(),
-				param.ErrorMessage,
-			)
-		}))
+	router.Use(otelgin.Middleware(
+		tracing.ServiceName,
+		otelgin.WithTracerProvider(tp),
+		otelgin.WithPropagators(propagation.TraceContext{}),
+	))
+	// Browsers are limited to same origin requests when no origins are set.
+	if len(appConfig.CORSOrigins) > 0 {
+		router.Use(corsMiddleware(appConfig.CORSOrigins))
+	}
+	router.Use(requestID())
+	router.Use(accessLog(log))
+	router.Use(observeRequests(m))
+
+	metroClient := metro.NewClient(appConfig, log, m, tp)
+	jobs := job.NewTracker()
+	bus := train.NewEventBus()
+	stations := station.NewRepository(ddbClient, appConfig, log)
+	historyRepo := history.NewRepository(ddbClient, appConfig, log)
 
 	server := &Server{
-		router: router,
+		router:   router,
+		log:      log,
+		jobs:     jobs,
+		feed:     train.NewFeed(),
+		bus:      bus,
+		trains:   train.NewRepository(ddbClient, appConfig, log, m),
+		poller:   train.NewPoller(appConfig, metroClient, bus, jobs, log, m, tp),
+		history:  historyRepo,
+		headways: headway.NewService(historyRepo, stations, appConfig, log),
+		tracker: tracker.NewTracker(
+			tracker.NewRoutes(appConfig, metroClient, log), log,
+		),
+		stations: stations,
+		ingester: station.NewIngester(appConfig, metroClient, stations, log),
+		metrics:  m,
+		health:   health.NewChecker(appConfig.HealthTimeout, readyCacheFor),
+		upgrader: newUpgrader(len(appConfig.CORSOrigins) > 0),
+		shutdown: make(chan struct{}),
 	}
+	server.registerHealthChecks(appConfig, ddbClient, metroClient)
+
+	// Storage subscribes first so snapshots are written before streaming
+	// clients see them.
+	bus.Subscribe(server.trains.StoreSnapshot)
+	bus.Subscribe(server.history.ArchiveSnapshot)
+	bus.Subscribe(server.tracker.HandleSnapshot)
+	bus.Subscribe(server.feed.HandleSnapshot)
 
-	server.setupRoutes()
-	return server
+	server.setupRoutes(appConfig, validate)
+	return server, nil
 }
 
 func main() {
-	log := config.GetLogger()
-	config := config.LoadConfig()
+	// "server migrate [flags]" applies pending migrations and exits.
+	args := os.Args[1:]
+	migrateOnly := len(args) > 0 && args[0] == "migrate"
+	if migrateOnly {
+		args = args[1:]
+	}
 
-	client, err := store.InitDB()
+	appConfig, err := config.Load(args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to load config.")
+	}
+
+	log := config.NewLogger(appConfig)
+
+	ctx, stop := signal.NotifyContext(
+		context.Background(), os.Interrupt, syscall.SIGTERM,
+	)
+	defer stop()
+
+	tp, shutdownTracing, err := tracing.NewProvider(ctx, appConfig)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to set up tracing.")
+	}
+
+	m := metrics.New()
+	ddbClient, err := store.NewClient(ctx, appConfig, m, tp)
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"error": err,
 		}).Fatal("failed to connect to DDB.")
 	}
-	ddbClient = client
-	// go train.PollTrainPredictions(ddbClient)
-	server := CreateGinServer()
-	if err := server.router.Run(
-		fmt.Sprintf(":%d", config.BindingPort)); err != nil {
+
+	if migrateOnly {
+		err := migrate(ctx, ddbClient, appConfig, log)
+		if flushErr := shutdownTracing(context.Background()); flushErr != nil {
+			log.WithError(flushErr).Error("failed to flush traces.")
+		}
+		if err != nil {
 			log.WithFields(logrus.Fields{
 				"error": err,
-			}).Fatal("failed to start server.")
+			}).Fatal("failed to migrate DDB.")
+		}
+		return
+	}
+
+	server, err := CreateGinServer(appConfig, log, ddbClient, m, tp)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create server.")
+	}
+	err = store.InitDB(ctx, ddbClient, appConfig, server.ingester, log)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to initialize DDB.")
+	}
+
+	if err := server.Run(ctx, appConfig); err != nil {
+		log.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("server did not shut down cleanly.")
+	}
+
+	flushCtx, cancel := context.WithTimeout(
+		context.Background(), appConfig.ShutdownTimeout,
+	)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.WithError(err).Error("failed to flush traces.")
 	}
+	log.Info("server stopped.")
 }
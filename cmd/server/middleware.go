@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/metrics"
+	"github.com/reww406/linetracker/internal/ratelimit"
+	"github.com/sirupsen/logrus"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestID reuses the caller's X-Request-ID or generates one, and stores it
+// on the request context so downstream log entries made with WithContext
+// include it.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		c.Header(requestIDHeader, id)
+		c.Request = c.Request.WithContext(
+			config.ContextWithRequestID(c.Request.Context(), id),
+		)
+		c.Next()
+	}
+}
+
+// accessLog logs every request through logrus so access logs share the
+// configured format and outputs.
+func accessLog(log *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		entry := log.WithContext(c.Request.Context()).WithFields(logrus.Fields{
+			"client_ip":  c.ClientIP(),
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"proto":      c.Request.Proto,
+			"status":     c.Writer.Status(),
+			"latency_ms": time.Since(start).Milliseconds(),
+			"user_agent": c.Request.UserAgent(),
+		})
+		if errs := c.Errors.ByType(gin.ErrorTypePrivate).String(); errs != "" {
+			entry = entry.WithField("error", errs)
+		}
+		entry.Info("request handled.")
+	}
+}
+
+// corsMiddleware allows browsers on origins to call the API and read the
+// request ID and rate limit headers.
+func corsMiddleware(origins []string) gin.HandlerFunc {
+	return cors.New(cors.Config{
+		AllowOrigins:  origins,
+		AllowWildcard: true,
+		AllowMethods:  []string{"GET", "POST", "OPTIONS"},
+		AllowHeaders: []string{
+			"Origin", "Content-Type", "Authorization",
+			apiKeyHeader, requestIDHeader,
+		},
+		ExposeHeaders: []string{
+			requestIDHeader, "Retry-After",
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+		},
+		MaxAge: 12 * time.Hour,
+	})
+}
+
+// observeRequests records request counts and latency by route template so
+// path parameters do not create a series per value.
+func observeRequests(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.ObserveHTTPRequest(
+			c.Request.Method, route, c.Writer.Status(), time.Since(start),
+		)
+	}
+}
+
+const (
+	apiKeyHeader = "X-API-Key"
+	// Browsers cannot set headers on EventSource or WebSocket requests.
+	apiKeyQuery = "api_key"
+	apiKeyCtx   = "api_key"
+)
+
+// requireAPIKey rejects requests without one of keys, every request is let
+// through when no keys are configured.
+func requireAPIKey(keys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(keys) == 0 {
+			c.Next()
+			return
+		}
+
+		provided := c.GetHeader(apiKeyHeader)
+		if provided == "" {
+			provided = c.Query(apiKeyQuery)
+		}
+		matched := false
+		for _, key := range keys {
+			// Compare against every key so timing does not reveal which
+			// prefix matched.
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) == 1 {
+				matched = true
+			}
+		}
+		if !matched {
+			abortWithError(c, apperror.New(
+				apperror.CodeUnauthenticated, "missing or invalid API key", nil,
+			))
+			return
+		}
+		c.Set(apiKeyCtx, provided)
+		c.Next()
+	}
+}
+
+// setRateLimitHeaders reports result unless an earlier limiter already
+// reported a bucket with fewer requests remaining.
+func setRateLimitHeaders(c *gin.Context, result ratelimit.Result) {
+	header := c.Writer.Header()
+	if current := header.Get("RateLimit-Remaining"); current != "" {
+		if remaining, err := strconv.Atoi(current); err == nil &&
+			remaining <= result.Remaining {
+			return
+		}
+	}
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// rateLimit takes a token from the bucket keyed by keyFn and responds 429
+// once it is empty. Requests keyFn returns no key for are not limited.
+func rateLimit(
+	limiter *ratelimit.Limiter, keyFn func(c *gin.Context) string,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := keyFn(c)
+		if limiter == nil || key == "" {
+			c.Next()
+			return
+		}
+
+		result := limiter.Allow(key)
+		setRateLimitHeaders(c, result)
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			abortWithError(c, apperror.New(
+				apperror.CodeRateLimited, "rate limit exceeded", nil,
+			))
+			return
+		}
+		c.Next()
+	}
+}
+
+func clientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+func apiKey(c *gin.Context) string {
+	return c.GetString(apiKeyCtx)
+}
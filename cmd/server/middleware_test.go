@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/internal/ratelimit"
+)
+
+func newLimitedRouter(keys []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET(
+		"/api/v1/lines",
+		rateLimit(ratelimit.New(1, 3), clientIP),
+		requireAPIKey(keys),
+		rateLimit(ratelimit.New(1, 1), apiKey),
+		func(c *gin.Context) { c.Status(http.StatusOK) },
+	)
+	return router
+}
+
+func get(router *gin.Engine, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/lines", nil)
+	if key != "" {
+		req.Header.Set(apiKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	router := newLimitedRouter([]string{"key-1", "key-2"})
+
+	if rec := get(router, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a key, got %d", rec.Code)
+	}
+	if rec := get(router, "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a bad key, got %d", rec.Code)
+	}
+	if rec := get(router, "key-2"); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 with a valid key, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitPerKeyAndIP(t *testing.T) {
+	router := newLimitedRouter([]string{"key-1", "key-2"})
+
+	rec := get(router, "key-1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected first request to pass, got %d", rec.Code)
+	}
+	// The key bucket is smaller so its headers win over the IP's.
+	if rec.Header().Get("RateLimit-Limit") != "1" ||
+		rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("expected key bucket headers, got %v", rec.Header())
+	}
+
+	rec = get(router, "key-1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected key to be limited, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After of 1, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	// Another key from the same IP still has the last IP token.
+	if rec := get(router, "key-2"); rec.Code != http.StatusOK {
+		t.Fatalf("expected other key to pass, got %d", rec.Code)
+	}
+	if rec := get(router, "key-2"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected IP to be limited, got %d", rec.Code)
+	}
+}
+
+func TestRequireAPIKeyAllowsAllWithoutKeys(t *testing.T) {
+	router := newLimitedRouter(nil)
+	if rec := get(router, ""); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 with no keys configured, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+// migrate applies pending schema migrations, for deployments that run them
+// ahead of the server with auto_migrate off.
+func migrate(
+	ctx context.Context,
+	ddbClient *dynamodb.Client,
+	appConfig *config.Configuration,
+	log *logrus.Logger,
+) error {
+	applied, err := store.NewMigrator(ddbClient, appConfig, log).Migrate(ctx)
+	if err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"applied": len(applied),
+	}).Info("schema is up to date.")
+	return nil
+}
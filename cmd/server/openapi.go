@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/internal/api"
+	"github.com/reww406/linetracker/internal/apperror"
+)
+
+// validateRequests rejects requests whose parameters do not match the
+// OpenAPI spec. Authentication is left to requireAPIKey and requests for
+// routes missing from the spec are left to gin.
+func validateRequests(doc *openapi3.T) (gin.HandlerFunc, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI router: %w", err)
+	}
+
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		err = openapi3filter.ValidateRequest(c, &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		})
+		if err != nil {
+			abortWithError(c, apperror.New(
+				apperror.CodeInvalidArgument, validationMessage(err), nil,
+			))
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+// validationMessage drops the request dump kin-openapi appends to errors.
+func validationMessage(err error) string {
+	if reqErr, ok := err.(*openapi3filter.RequestError); ok {
+		if reqErr.Parameter != nil {
+			return fmt.Sprintf(
+				"invalid %s parameter %q: %s",
+				reqErr.Parameter.In, reqErr.Parameter.Name, reasonOf(reqErr),
+			)
+		}
+		return reasonOf(reqErr)
+	}
+	if _, ok := err.(*routers.RouteError); ok {
+		return "route not found"
+	}
+	return err.Error()
+}
+
+func reasonOf(reqErr *openapi3filter.RequestError) string {
+	if reqErr.Reason != "" {
+		return reqErr.Reason
+	}
+	if schemaErr, ok := reqErr.Err.(*openapi3.SchemaError); ok {
+		return schemaErr.Reason
+	}
+	if reqErr.Err != nil {
+		return reqErr.Err.Error()
+	}
+	return "invalid request"
+}
+
+func (s *Server) getOpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", api.SpecJSON())
+}
+
+func (s *Server) getDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", api.DocsHTML())
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/api"
+	"github.com/reww406/linetracker/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+func newSpecServer(t *testing.T) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	spec, err := api.LoadSpec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	validate, err := validateRequests(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{router: gin.New(), log: logrus.New(), metrics: metrics.New()}
+	s.setupRoutes(&config.Configuration{}, validate)
+	return s
+}
+
+// specPath writes gin's :param path segments the OpenAPI way, {param}.
+func specPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func TestSpecCoversEveryRoute(t *testing.T) {
+	s := newSpecServer(t)
+	spec, err := api.LoadSpec(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := make(map[string]bool)
+	for _, route := range s.router.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/v1/") {
+			continue
+		}
+		path := specPath(route.Path)
+		key := route.Method + " " + path
+		routes[key] = true
+		item := spec.Paths.Find(path)
+		if item == nil || item.GetOperation(route.Method) == nil {
+			t.Errorf("%s is served but missing from the OpenAPI spec", key)
+		}
+	}
+
+	for path, item := range spec.Paths.Map() {
+		for method := range item.Operations() {
+			if !routes[method+" "+path] {
+				t.Errorf("%s %s is in the OpenAPI spec but not served", method, path)
+			}
+		}
+	}
+}
+
+func TestRequestsAreValidatedAgainstSpec(t *testing.T) {
+	s := newSpecServer(t)
+
+	for _, target := range []string{
+		"/api/v1/stations?limit=0",
+		"/api/v1/stations?sort=zip",
+		"/api/v1/stations?line_code=XX",
+		"/api/v1/trains",
+		"/api/v1/trains/stream?line_code=RD",
+		"/api/v1/lines/XX/positions",
+	} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d %s", target, rec.Code, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/lines", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected valid request to pass, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"openapi"`) {
+		t.Errorf("expected the spec to be served, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/internal/api"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/train"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	// Tells EventSource clients how long to wait before reconnecting.
+	reconnectDelayMs = 3000
+)
+
+func filterByLine(trains []train.TrainModel, lineCode string) []train.TrainModel {
+	if lineCode == "" {
+		return trains
+	}
+	result := make([]train.TrainModel, 0, len(trains))
+	for _, t := range trains {
+		if t.LineCode == lineCode {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// initialSnapshot returns what a client should see on connect, preferring
+// the last snapshot the poller published and falling back to the latest
+// poll stored in DDB after a restart.
+func (s *Server) initialSnapshot(
+	c *gin.Context, locationCode string, lineCode string,
+) (train.Snapshot, error) {
+	if snapshot, ok := s.feed.Latest(locationCode); ok {
+		return snapshot, nil
+	}
+
+	trains, err := s.trains.GetTrainPredictions(c, train.GetNextTrainsRequest{
+		LineCode:     metro.LineCode(lineCode),
+		LocationCode: locationCode,
+	})
+	if err != nil {
+		return train.Snapshot{}, err
+	}
+
+	trains = train.LatestPoll(trains)
+	snapshot := train.Snapshot{LocationCode: locationCode}
+	for _, t := range trains {
+		if t.CreatedEpochMs > snapshot.ID {
+			snapshot.ID = t.CreatedEpochMs
+		}
+	}
+	snapshot.Trains = trains
+	return snapshot, nil
+}
+
+func writeSnapshot(c *gin.Context, snapshot train.Snapshot, lineCode string) {
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatInt(snapshot.ID, 10),
+		Event: "predictions",
+		Retry: reconnectDelayMs,
+		Data: api.NewListResponse(
+			api.NewTrains(filterByLine(snapshot.Trains, lineCode)), "",
+		),
+	})
+}
+
+// api/v1/trains/stream?location_code=K08&line_code=OR
+func (s *Server) streamTrains(c *gin.Context) {
+	locationCode := c.Query("location_code")
+	lineCode := c.Query("line_code")
+	if locationCode == "" {
+		abortWithError(c, apperror.InvalidArgument("location_code is required"))
+		return
+	}
+
+	// Clients reconnecting send the id of the last snapshot they saw so they
+	// are not sent it twice.
+	lastEventID, _ := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64)
+
+	updates, unsubscribe := s.feed.Subscribe(locationCode)
+	defer unsubscribe()
+
+	snapshot, err := s.initialSnapshot(c, locationCode, lineCode)
+	if err != nil {
+		abortWithError(c, fmt.Errorf("failed to get initial train snapshot: %w", err))
+		return
+	}
+
+	// The stream outlives the server's WriteTimeout.
+	rc := http.NewResponseController(c.Writer)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		s.log.WithContext(c).WithError(err).Warn(
+			"failed to clear write deadline for stream.",
+		)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Stops nginx from buffering the stream.
+	c.Header("X-Accel-Buffering", "no")
+
+	if snapshot.ID > lastEventID {
+		writeSnapshot(c, snapshot, lineCode)
+		lastEventID = snapshot.ID
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-s.shutdown:
+			return false
+		case snapshot := <-updates:
+			if snapshot.ID <= lastEventID {
+				return true
+			}
+			writeSnapshot(c, snapshot, lineCode)
+			lastEventID = snapshot.ID
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		}
+	})
+}
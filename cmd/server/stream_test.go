@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reww406/linetracker/internal/train"
+	"github.com/sirupsen/logrus"
+)
+
+func publish(t *testing.T, feed *train.Feed, ms int64, trains ...train.TrainModel) {
+	t.Helper()
+	err := feed.HandleSnapshot(context.Background(), train.PredictionSnapshot{
+		Timestamp: time.UnixMilli(ms),
+		Locations: map[string][]train.TrainModel{"K08": trains},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readEvent returns the fields of the next event, skipping heartbeats.
+func readEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	event := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			if len(event) > 0 {
+				return event
+			}
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok && key != "" {
+			event[key] = value
+		}
+	}
+}
+
+func TestStreamTrainsSendsInitialAndUpdates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{
+		router:   gin.New(),
+		log:      logrus.New(),
+		feed:     train.NewFeed(),
+		shutdown: make(chan struct{}),
+	}
+	s.router.GET("/api/v1/trains/stream", s.streamTrains)
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+	defer close(s.shutdown)
+
+	publish(t, s.feed, 1000,
+		train.TrainModel{LocationCode: "K08", LineCode: "OR"},
+		train.TrainModel{LocationCode: "K08", LineCode: "SV"},
+	)
+
+	resp, err := http.Get(srv.URL + "/api/v1/trains/stream?location_code=K08&line_code=OR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+
+	initial := readEvent(t, r)
+	if initial["id"] != "1000" || initial["event"] != "predictions" ||
+		!strings.Contains(initial["data"], `"count":1`) ||
+		strings.Contains(initial["data"], `"SV"`) {
+		t.Fatalf("unexpected initial event %v", initial)
+	}
+
+	// The stream subscribes before sending the initial snapshot.
+	publish(t, s.feed, 2000, train.TrainModel{LocationCode: "K08", LineCode: "OR"})
+	update := readEvent(t, r)
+	if update["id"] != "2000" {
+		t.Fatalf("unexpected update %v", update)
+	}
+}
+
+func TestStreamTrainsSkipsSnapshotsAlreadySeen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{
+		router:   gin.New(),
+		log:      logrus.New(),
+		feed:     train.NewFeed(),
+		shutdown: make(chan struct{}),
+	}
+	s.router.GET("/api/v1/trains/stream", s.streamTrains)
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+	defer close(s.shutdown)
+
+	publish(t, s.feed, 1000, train.TrainModel{LocationCode: "K08"})
+	req, err := http.NewRequest(
+		http.MethodGet, srv.URL+"/api/v1/trains/stream?location_code=K08", nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "1000")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	publish(t, s.feed, 2000, train.TrainModel{LocationCode: "K08"})
+	if event := readEvent(t, bufio.NewReader(resp.Body)); event["id"] != "2000" {
+		t.Fatalf("expected only the new snapshot, got %v", event)
+	}
+}
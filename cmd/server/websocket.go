@@ -0,0 +1,291 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/reww406/linetracker/internal/api"
+	"golang.org/x/time/rate"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = (wsPongWait * 9) / 10
+	wsMaxMessageSize = 1024
+	// The rate limit middleware only sees the upgrade, each subscribe can
+	// read DDB so connections are limited on their own.
+	wsMaxSubscriptions = 20
+	wsMessageRate      = rate.Limit(10)
+	wsMessageBurst     = 30
+)
+
+// WMATA station codes, a letter and two digits.
+var locationCodePattern = regexp.MustCompile(`^[A-Z][0-9]{2}$`)
+
+// Message types of the websocket protocol.
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+	wsSnapshot    = "snapshot"
+	wsUpdate      = "update"
+	wsError       = "error"
+)
+
+// newUpgrader leaves origin checks to the CORS middleware when it is enabled
+// and otherwise only accepts same origin connections.
+func newUpgrader(corsEnabled bool) *websocket.Upgrader {
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
+	if corsEnabled {
+		upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	}
+	return upgrader
+}
+
+// wsRequest is sent by the client, {"type": "subscribe", "location_code":
+// "K08", "line_code": "OR"}. line_code is optional.
+type wsRequest struct {
+	Type         string `json:"type"`
+	LocationCode string `json:"location_code"`
+	LineCode     string `json:"line_code"`
+}
+
+type wsMessage struct {
+	Type         string      `json:"type"`
+	LocationCode string      `json:"location_code,omitempty"`
+	LineCode     string      `json:"line_code,omitempty"`
+	ID           int64       `json:"id,omitempty"`
+	Trains       []api.Train `json:"trains,omitempty"`
+	Error        string      `json:"error,omitempty"`
+}
+
+type wsSubscription struct {
+	locationCode string
+	lineCode     string
+}
+
+type wsClient struct {
+	server *Server
+	conn   *websocket.Conn
+	out    chan wsMessage
+	done   chan struct{}
+	// Only touched by the read loop.
+	subs    map[wsSubscription]func()
+	limiter *rate.Limiter
+}
+
+func (wc *wsClient) send(msg wsMessage) {
+	select {
+	case wc.out <- msg:
+	case <-wc.done:
+	}
+}
+
+func (wc *wsClient) sendError(errMsg string, req wsRequest) {
+	wc.send(wsMessage{
+		Type:         wsError,
+		LocationCode: req.LocationCode,
+		LineCode:     req.LineCode,
+		Error:        errMsg,
+	})
+}
+
+func (wc *wsClient) subscribe(c *gin.Context, req wsRequest) {
+	if req.LocationCode == "" {
+		wc.sendError("location_code is required", req)
+		return
+	}
+	if !locationCodePattern.MatchString(req.LocationCode) {
+		wc.sendError("location_code is not a station code", req)
+		return
+	}
+	sub := wsSubscription{req.LocationCode, req.LineCode}
+	if unsubscribe, ok := wc.subs[sub]; ok {
+		unsubscribe()
+	} else if len(wc.subs) >= wsMaxSubscriptions {
+		wc.sendError("too many subscriptions", req)
+		return
+	}
+
+	updates, unsubscribe := wc.server.feed.Subscribe(req.LocationCode)
+	stop := make(chan struct{})
+	wc.subs[sub] = func() {
+		unsubscribe()
+		close(stop)
+	}
+
+	// Snapshots published between subscribing and reading the initial one
+	// are delivered again as updates, only newer ones are sent.
+	var sentID int64
+	snapshot, err := wc.server.initialSnapshot(c, req.LocationCode, req.LineCode)
+	if err != nil {
+		wc.server.log.WithContext(c).WithError(err).Errorln(
+			"failed to get initial train snapshot",
+		)
+		wc.sendError("failed to get trains", req)
+	} else {
+		sentID = snapshot.ID
+		wc.send(wsMessage{
+			Type:         wsSnapshot,
+			LocationCode: req.LocationCode,
+			LineCode:     req.LineCode,
+			ID:           snapshot.ID,
+			Trains: api.NewTrains(
+				filterByLine(snapshot.Trains, req.LineCode),
+			),
+		})
+	}
+
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-wc.done:
+				return
+			case snapshot := <-updates:
+				if snapshot.ID <= sentID {
+					continue
+				}
+				sentID = snapshot.ID
+				wc.send(wsMessage{
+					Type:         wsUpdate,
+					LocationCode: req.LocationCode,
+					LineCode:     req.LineCode,
+					ID:           snapshot.ID,
+					Trains: api.NewTrains(
+						filterByLine(snapshot.Trains, req.LineCode),
+					),
+				})
+			}
+		}
+	}()
+}
+
+func (wc *wsClient) unsubscribe(req wsRequest) {
+	sub := wsSubscription{req.LocationCode, req.LineCode}
+	unsubscribe, ok := wc.subs[sub]
+	if !ok {
+		wc.sendError("not subscribed", req)
+		return
+	}
+	unsubscribe()
+	delete(wc.subs, sub)
+}
+
+func (wc *wsClient) readLoop(c *gin.Context) {
+	wc.conn.SetReadLimit(wsMaxMessageSize)
+	_ = wc.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	wc.conn.SetPongHandler(func(string) error {
+		return wc.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var req wsRequest
+		if err := wc.conn.ReadJSON(&req); err != nil {
+			if websocket.IsUnexpectedCloseError(
+				err, websocket.CloseGoingAway, websocket.CloseNormalClosure,
+			) {
+				wc.server.log.WithContext(c).WithError(err).Warn(
+					"websocket closed unexpectedly.",
+				)
+			}
+			return
+		}
+		if !wc.limiter.Allow() {
+			wc.sendError("rate limited", req)
+			continue
+		}
+
+		switch req.Type {
+		case wsSubscribe:
+			wc.subscribe(c, req)
+		case wsUnsubscribe:
+			wc.unsubscribe(req)
+		default:
+			wc.sendError("unknown message type", req)
+		}
+	}
+}
+
+func (wc *wsClient) writeLoop() {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-wc.done:
+			_ = wc.conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(wsWriteWait),
+			)
+			return
+		case <-wc.server.shutdown:
+			_ = wc.conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""),
+				time.Now().Add(wsWriteWait),
+			)
+			// Unblocks the read loop so the client is cleaned up.
+			_ = wc.conn.Close()
+			return
+		case msg := <-wc.out:
+			_ = wc.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := wc.conn.WriteJSON(msg); err != nil {
+				// Unblocks the read loop so the client is cleaned up.
+				_ = wc.conn.Close()
+				return
+			}
+		case <-ping.C:
+			_ = wc.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := wc.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				_ = wc.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (wc *wsClient) close() {
+	for _, unsubscribe := range wc.subs {
+		unsubscribe()
+	}
+	close(wc.done)
+}
+
+// api/v1/trains/ws
+func (s *Server) websocketTrains(c *gin.Context) {
+	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written the error response.
+		s.log.WithContext(c).WithError(err).Warn("failed to upgrade websocket.")
+		return
+	}
+
+	client := &wsClient{
+		server:  s,
+		conn:    conn,
+		out:     make(chan wsMessage, 16),
+		done:    make(chan struct{}),
+		subs:    make(map[wsSubscription]func()),
+		limiter: rate.NewLimiter(wsMessageRate, wsMessageBurst),
+	}
+
+	writerDone := make(chan struct{})
+	go func() {
+		client.writeLoop()
+		close(writerDone)
+	}()
+
+	client.readLoop(c)
+	client.close()
+	<-writerDone
+	_ = conn.Close()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/reww406/linetracker/internal/train"
+	"github.com/sirupsen/logrus"
+)
+
+func readMessage(t *testing.T, conn *websocket.Conn) wsMessage {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	return msg
+}
+
+// dialWebsocket serves the websocket route and connects to it. write sends
+// a request.
+func dialWebsocket(t *testing.T) (*Server, *websocket.Conn, func(wsRequest)) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	s := &Server{
+		router:   gin.New(),
+		log:      logrus.New(),
+		feed:     train.NewFeed(),
+		upgrader: newUpgrader(false),
+		shutdown: make(chan struct{}),
+	}
+	s.router.GET("/api/v1/trains/ws", s.websocketTrains)
+	srv := httptest.NewServer(s.router)
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(s.shutdown) })
+
+	conn, _, err := websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(srv.URL, "http")+"/api/v1/trains/ws", nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return s, conn, func(req wsRequest) {
+		t.Helper()
+		if err := conn.WriteJSON(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWebsocketTrainsSubscribeUpdateUnsubscribe(t *testing.T) {
+	s, conn, write := dialWebsocket(t)
+	publish(t, s.feed, 1000,
+		train.TrainModel{LocationCode: "K08", LineCode: "OR"},
+		train.TrainModel{LocationCode: "K08", LineCode: "SV"},
+	)
+
+	write(wsRequest{Type: wsSubscribe})
+	if msg := readMessage(t, conn); msg.Type != wsError ||
+		msg.Error != "location_code is required" {
+		t.Fatalf("expected a location_code error, got %+v", msg)
+	}
+
+	sub := wsRequest{Type: wsSubscribe, LocationCode: "K08", LineCode: "OR"}
+	write(sub)
+	msg := readMessage(t, conn)
+	if msg.Type != wsSnapshot || msg.ID != 1000 || len(msg.Trains) != 1 {
+		t.Fatalf("expected the initial snapshot, got %+v", msg)
+	}
+
+	// Already sent as the snapshot, only the newer one is an update.
+	publish(t, s.feed, 1000, train.TrainModel{LocationCode: "K08", LineCode: "OR"})
+	publish(t, s.feed, 2000, train.TrainModel{LocationCode: "K08", LineCode: "OR"})
+	if msg := readMessage(t, conn); msg.Type != wsUpdate || msg.ID != 2000 {
+		t.Fatalf("expected update 2000, got %+v", msg)
+	}
+
+	sub.Type = wsUnsubscribe
+	write(sub)
+	// The second unsubscribe fails, so the first has been handled.
+	write(sub)
+	if msg := readMessage(t, conn); msg.Type != wsError || msg.Error != "not subscribed" {
+		t.Fatalf("expected not subscribed, got %+v", msg)
+	}
+
+	publish(t, s.feed, 3000, train.TrainModel{LocationCode: "K08", LineCode: "OR"})
+	write(wsRequest{Type: "ping"})
+	if msg := readMessage(t, conn); msg.Type != wsError || msg.Error != "unknown message type" {
+		t.Fatalf("expected no update after unsubscribe, got %+v", msg)
+	}
+}
+
+func TestWebsocketTrainsLimitsSubscriptions(t *testing.T) {
+	s, conn, write := dialWebsocket(t)
+	var codes []string
+	locations := map[string][]train.TrainModel{}
+	for i := 0; i <= wsMaxSubscriptions; i++ {
+		code := fmt.Sprintf("A%02d", i)
+		codes = append(codes, code)
+		locations[code] = []train.TrainModel{{LocationCode: code}}
+	}
+	err := s.feed.HandleSnapshot(context.Background(), train.PredictionSnapshot{
+		Timestamp: time.UnixMilli(1000),
+		Locations: locations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(wsRequest{Type: wsSubscribe, LocationCode: "k08; drop"})
+	if msg := readMessage(t, conn); msg.Type != wsError ||
+		msg.Error != "location_code is not a station code" {
+		t.Fatalf("expected a bad location_code error, got %+v", msg)
+	}
+
+	for _, code := range codes {
+		write(wsRequest{Type: wsSubscribe, LocationCode: code})
+	}
+	for range wsMaxSubscriptions {
+		if msg := readMessage(t, conn); msg.Type != wsSnapshot {
+			t.Fatalf("expected a snapshot, got %+v", msg)
+		}
+	}
+	if msg := readMessage(t, conn); msg.Type != wsError ||
+		msg.Error != "too many subscriptions" {
+		t.Fatalf("expected too many subscriptions, got %+v", msg)
+	}
+
+	// Resubscribing does not add a subscription.
+	write(wsRequest{Type: wsSubscribe, LocationCode: "A00"})
+	if msg := readMessage(t, conn); msg.Type != wsSnapshot {
+		t.Fatalf("expected a snapshot, got %+v", msg)
+	}
+
+	for range wsMessageBurst {
+		write(wsRequest{Type: "ping"})
+	}
+	for {
+		msg := readMessage(t, conn)
+		if msg.Error == "rate limited" {
+			break
+		}
+		if msg.Error != "unknown message type" {
+			t.Fatalf("expected the flood to be rate limited, got %+v", msg)
+		}
+	}
+}
@@ -1,25 +1,65 @@
 package config
 
 import (
-	"encoding/json"
 	"net/http"
-	"os"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/sirupsen/logrus"
 )
 
 // Internal configuration for JSON
 type jsonConfig struct {
-	APIKey             string `json:"api_key"`
-	BindingPort        int    `json:"binding_port"`
-	IsProd             bool   `json:"prod"`
-	TrainRoute         string `json:"train_route"`
-	StationRoute       string `json:"station_route"`
-	StationTimingRoute string `json:"station_timing_route"`
-	APIEndpoint        string `json:"api_endpoint"`
+	APIKey               string `json:"api_key"`
+	BindingPort          int    `json:"binding_port"`
+	IsProd               bool   `json:"prod"`
+	TrainRoute           string `json:"train_route"`
+	StationRoute         string `json:"station_route"`
+	StationTimingRoute   string `json:"station_timing_route"`
+	LineRoute            string `json:"line_route"`
+	PathRoute            string `json:"path_route"`
+	APIEndpoint          string `json:"api_endpoint"`
+	AdminToken           string `json:"admin_token"`
+	ReadTimeoutSec       int    `json:"read_timeout_sec"`
+	WriteTimeoutSec      int    `json:"write_timeout_sec"`
+	IdleTimeoutSec       int    `json:"idle_timeout_sec"`
+	ShutdownTimeoutSec   int    `json:"shutdown_timeout_sec"`
+	DDBEndpoint          string `json:"ddb_endpoint"`
+	DDBRegion            string `json:"ddb_region"`
+	DDBAccessKeyID       string `json:"ddb_access_key_id"`
+	DDBSecretAccessKey   string `json:"ddb_secret_access_key"`
+	DDBSessionToken      string `json:"ddb_session_token"`
+	TablePrefix          string `json:"table_prefix"`
+	StationTable         string `json:"station_table"`
+	PredictionTable      string `json:"prediction_table"`
+	MigrationTable       string `json:"migration_table"`
+	AutoMigrate          bool   `json:"auto_migrate"`
+	TrainRetentionDays   int    `json:"train_retention_days"`
+	HistoryTable         string `json:"history_table"`
+	HistoryRetentionDays int    `json:"history_retention_days"`
+	HeadwayGapMinutes    int    `json:"headway_gap_minutes"`
+	PollIntervalSec      int    `json:"poll_interval_sec"`
+	StationRefreshHours  int    `json:"station_refresh_hours"`
+	LogLevel             string `json:"log_level"`
+	LogFormat            string `json:"log_format"`
+	LogOutputs           string `json:"log_outputs"`
+	LogFile              string `json:"log_file"`
+	LogMaxSizeMB         int    `json:"log_max_size_mb"`
+	LogMaxAgeDays        int    `json:"log_max_age_days"`
+	LogMaxBackups        int    `json:"log_max_backups"`
+	HealthTimeoutSec     int    `json:"health_timeout_sec"`
+	HealthMaxAgeSec      int    `json:"health_max_age_sec"`
+	TraceExporter        string `json:"trace_exporter"`
+	TraceEndpoint        string `json:"trace_endpoint"`
+	APIKeys              string `json:"api_keys"`
+	CORSOrigins          string `json:"cors_origins"`
+	TrustedProxies       string `json:"trusted_proxies"`
+	RateLimitIPRPS       int    `json:"rate_limit_ip_rps"`
+	RateLimitIPBurst     int    `json:"rate_limit_ip_burst"`
+	RateLimitKeyRPS      int    `json:"rate_limit_key_rps"`
+	RateLimitKeyBurst    int    `json:"rate_limit_key_burst"`
+	StationCacheTTLSec   int    `json:"station_cache_ttl_sec"`
 }
 
 type Configuration struct {
@@ -29,8 +69,99 @@ type Configuration struct {
 	trainRoute         string
 	stationRoute       string
 	stationTimingRoute string
+	lineRoute          string
+	pathRoute          string
 	APIEndpoint        string
-	Client             *http.Client
+	// Bearer token required on /admin routes, admin routes are disabled when
+	// empty.
+	AdminToken   string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// How long in-flight requests and background jobs get to finish once a
+	// shutdown signal is received.
+	ShutdownTimeout time.Duration
+	// Empty in prod unless set, which uses the regular AWS endpoint.
+	DDBEndpoint string
+	DDBRegion   string
+	// When no access key is set the default AWS credential chain is used.
+	DDBAccessKeyID     string
+	DDBSecretAccessKey string
+	DDBSessionToken    string
+	tablePrefix        string
+	stationTable       string
+	predictionTable    string
+	migrationTable     string
+	// Apply pending schema migrations on startup, otherwise startup fails
+	// while any are pending.
+	AutoMigrate bool
+	// How long stored predictions are kept before DDB's TTL removes them, 0
+	// keeps them forever.
+	TrainRetention time.Duration
+	historyTable   string
+	// How long archived snapshots are kept, 0 keeps them forever.
+	HistoryRetention time.Duration
+	// Headways longer than this are reported as service gaps.
+	HeadwayGapThreshold time.Duration
+	// How often the poller fetches predictions from WMATA.
+	PollInterval time.Duration
+	// How often stations are re-ingested from WMATA, 0 only ingests them
+	// when the table is empty at startup.
+	StationRefresh time.Duration
+	LogLevel       logrus.Level
+	// text or json.
+	LogFormat string
+	// Any of stdout, stderr and file.
+	LogOutputs []string
+	// Rotated once it reaches LogMaxSizeMB, rotated files are removed after
+	// LogMaxAgeDays or once there are more than LogMaxBackups.
+	LogFile       string
+	LogMaxSizeMB  int
+	LogMaxAgeDays int
+	LogMaxBackups int
+	// How long each readiness check may take.
+	HealthTimeout time.Duration
+	// How old the last WMATA call and stored snapshot may be while the poller
+	// runs before the service reports not ready.
+	HealthMaxAge time.Duration
+	// none, stdout or otlp.
+	TraceExporter string
+	// OTLP/HTTP traces URL, the exporter's default or OTEL_EXPORTER_OTLP_*
+	// env vars are used when empty.
+	TraceEndpoint string
+	// Keys accepted on /api/v1, the API is open when empty.
+	APIKeys []string
+	// Origins allowed by CORS, "*" allows any. Empty, the default, only
+	// allows same origin requests.
+	CORSOrigins []string
+	// Proxies whose X-Forwarded-For is trusted for the client IP, none when
+	// empty.
+	TrustedProxies []string
+	// Token bucket refill rate per second and size, a rate of 0 disables
+	// the limit.
+	RateLimitIPRPS    int
+	RateLimitIPBurst  int
+	RateLimitKeyRPS   int
+	RateLimitKeyBurst int
+	// How long a scan of the stations table is reused, 0 disables caching.
+	StationCacheTTL time.Duration
+	Client          *http.Client
+}
+
+func (c *Configuration) StationTableName() *string {
+	return aws.String(c.tablePrefix + c.stationTable)
+}
+
+func (c *Configuration) PredictionTableName() *string {
+	return aws.String(c.tablePrefix + c.predictionTable)
+}
+
+func (c *Configuration) MigrationTableName() *string {
+	return aws.String(c.tablePrefix + c.migrationTable)
+}
+
+func (c *Configuration) HistoryTableName() *string {
+	return aws.String(c.tablePrefix + c.historyTable)
 }
 
 func (c *Configuration) GetTrainAPI() string {
@@ -47,50 +178,91 @@ func (c *Configuration) GetStationTimingAPI(stationCode string) string {
 	}, "")
 }
 
-var (
-	config        Configuration
-	configureOnce sync.Once
-)
+func (c *Configuration) GetLineAPI() string {
+	return strings.Join([]string{c.APIEndpoint, c.lineRoute}, "")
+}
 
-func LoadConfig() *Configuration {
-	log := GetLogger()
-	configureOnce.Do(func() {
-		file, err := os.Open("config.json")
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"error": err,
-			}).Fatal("failed to load config.")
-		}
-		defer func() {
-			cerr := file.Close()
-			if cerr != nil {
-				log.WithError(cerr).Error("failed to close config file stream.")
-			}
-		}()
-
-		var j jsonConfig
-		decoder := json.NewDecoder(file)
-		decoder.DisallowUnknownFields()
-		err = decoder.Decode(&j)
-		if err != nil {
-			log.WithFields(logrus.Fields{
-				"error": err,
-			}).Fatal("failed to load config.")
-		}
+// GetPathAPI is the ordered stations between two stations on one line.
+func (c *Configuration) GetPathAPI(fromStationCode, toStationCode string) string {
+	return strings.Join([]string{
+		c.APIEndpoint, c.pathRoute,
+		"?FromStationCode=", fromStationCode, "&ToStationCode=", toStationCode,
+	}, "")
+}
 
-		config = Configuration{
-			APIKey:             j.APIKey,
-			BindingPort:        j.BindingPort,
-			IsProd:             j.IsProd,
-			trainRoute:         j.TrainRoute,
-			stationRoute:       j.StationRoute,
-			stationTimingRoute: j.StationTimingRoute,
-			APIEndpoint:        j.APIEndpoint,
-			Client: &http.Client{
-				Timeout: 10 * time.Second,
-			},
+// splitList splits a comma separated setting, dropping empty entries.
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
 		}
-	})
+	}
+	return result
+}
+
+func parseLevelOrInfo(level string) logrus.Level {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return parsed
+}
 
-	return &config
+func (j *jsonConfig) toConfiguration() Configuration {
+	return Configuration{
+		APIKey:              j.APIKey,
+		BindingPort:         j.BindingPort,
+		IsProd:              j.IsProd,
+		trainRoute:          j.TrainRoute,
+		lineRoute:           j.LineRoute,
+		pathRoute:           j.PathRoute,
+		stationRoute:        j.StationRoute,
+		stationTimingRoute:  j.StationTimingRoute,
+		APIEndpoint:         j.APIEndpoint,
+		AdminToken:          j.AdminToken,
+		ReadTimeout:         time.Duration(j.ReadTimeoutSec) * time.Second,
+		WriteTimeout:        time.Duration(j.WriteTimeoutSec) * time.Second,
+		IdleTimeout:         time.Duration(j.IdleTimeoutSec) * time.Second,
+		ShutdownTimeout:     time.Duration(j.ShutdownTimeoutSec) * time.Second,
+		DDBEndpoint:         j.DDBEndpoint,
+		DDBRegion:           j.DDBRegion,
+		DDBAccessKeyID:      j.DDBAccessKeyID,
+		DDBSecretAccessKey:  j.DDBSecretAccessKey,
+		DDBSessionToken:     j.DDBSessionToken,
+		tablePrefix:         j.TablePrefix,
+		stationTable:        j.StationTable,
+		predictionTable:     j.PredictionTable,
+		migrationTable:      j.MigrationTable,
+		AutoMigrate:         j.AutoMigrate,
+		TrainRetention:      time.Duration(j.TrainRetentionDays) * 24 * time.Hour,
+		historyTable:        j.HistoryTable,
+		HistoryRetention:    time.Duration(j.HistoryRetentionDays) * 24 * time.Hour,
+		HeadwayGapThreshold: time.Duration(j.HeadwayGapMinutes) * time.Minute,
+		PollInterval:        time.Duration(j.PollIntervalSec) * time.Second,
+		StationRefresh:      time.Duration(j.StationRefreshHours) * time.Hour,
+		// Already checked by validate.
+		LogLevel:          parseLevelOrInfo(j.LogLevel),
+		LogFormat:         j.LogFormat,
+		LogOutputs:        splitList(j.LogOutputs),
+		LogFile:           j.LogFile,
+		LogMaxSizeMB:      j.LogMaxSizeMB,
+		LogMaxAgeDays:     j.LogMaxAgeDays,
+		LogMaxBackups:     j.LogMaxBackups,
+		HealthTimeout:     time.Duration(j.HealthTimeoutSec) * time.Second,
+		HealthMaxAge:      time.Duration(j.HealthMaxAgeSec) * time.Second,
+		TraceExporter:     j.TraceExporter,
+		TraceEndpoint:     j.TraceEndpoint,
+		APIKeys:           splitList(j.APIKeys),
+		CORSOrigins:       splitList(j.CORSOrigins),
+		TrustedProxies:    splitList(j.TrustedProxies),
+		RateLimitIPRPS:    j.RateLimitIPRPS,
+		RateLimitIPBurst:  j.RateLimitIPBurst,
+		RateLimitKeyRPS:   j.RateLimitKeyRPS,
+		RateLimitKeyBurst: j.RateLimitKeyBurst,
+		StationCacheTTL:   time.Duration(j.StationCacheTTLSec) * time.Second,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
 }
@@ -0,0 +1,432 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	envPrefix         = "LINETRACKER_"
+	defaultConfigFile = "config.json"
+	// DynamoDB Local from docker-compose.yml.
+	localDDBEndpoint = "http://localhost:8000/"
+	localDDBKey      = "local"
+)
+
+// ValidationError lists every configuration field that is missing or bad.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf(
+		"invalid configuration: %s", strings.Join(e.Problems, "; "),
+	)
+}
+
+func defaultJSONConfig() jsonConfig {
+	return jsonConfig{
+		BindingPort:          8080,
+		TrainRoute:           "/StationPrediction.svc/json/GetPrediction/All",
+		StationRoute:         "/Rail.svc/json/jStations",
+		StationTimingRoute:   "/Rail.svc/json/jStationTimes?StationCode=",
+		LineRoute:            "/Rail.svc/json/jLines",
+		PathRoute:            "/Rail.svc/json/jPath",
+		APIEndpoint:          "https://api.wmata.com",
+		ReadTimeoutSec:       10,
+		WriteTimeoutSec:      30,
+		IdleTimeoutSec:       60,
+		ShutdownTimeoutSec:   30,
+		DDBRegion:            "us-east-1",
+		StationTable:         "stations",
+		PredictionTable:      "train_predictions",
+		MigrationTable:       "schema_migrations",
+		AutoMigrate:          true,
+		TrainRetentionDays:   7,
+		HistoryTable:         "train_history",
+		HistoryRetentionDays: 90,
+		HeadwayGapMinutes:    20,
+		PollIntervalSec:      20,
+		StationRefreshHours:  24,
+		LogLevel:             "info",
+		LogFormat:            "text",
+		LogFile:              "logs/app.log",
+		LogMaxSizeMB:         100,
+		LogMaxAgeDays:        7,
+		LogMaxBackups:        5,
+		HealthTimeoutSec:     2,
+		HealthMaxAgeSec:      120,
+		TraceExporter:        "none",
+		RateLimitIPRPS:       5,
+		RateLimitIPBurst:     20,
+		RateLimitKeyRPS:      20,
+		RateLimitKeyBurst:    50,
+		StationCacheTTLSec:   3600,
+	}
+}
+
+// applyModeDefaults points outside of prod at DynamoDB Local unless told
+// otherwise, prod keeps the AWS endpoint and default credential chain and
+// also logs to a file.
+func (j *jsonConfig) applyModeDefaults() {
+	if j.LogOutputs == "" {
+		j.LogOutputs = "stdout"
+		if j.IsProd {
+			j.LogOutputs = "stdout,file"
+		}
+	}
+	if j.IsProd {
+		return
+	}
+	if j.DDBEndpoint == "" {
+		j.DDBEndpoint = localDDBEndpoint
+	}
+	if j.DDBAccessKeyID == "" && j.DDBSecretAccessKey == "" {
+		j.DDBAccessKeyID = localDDBKey
+		j.DDBSecretAccessKey = localDDBKey
+		j.DDBSessionToken = localDDBKey
+	}
+}
+
+// jsonFields calls fn with the JSON name of every jsonConfig field, env vars
+// and flags are derived from these names so they always match the file.
+func jsonFields(j *jsonConfig, fn func(name string, field reflect.Value)) {
+	v := reflect.ValueOf(j).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		fn(name, v.Field(i))
+	}
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported config type %s", field.Kind())
+	}
+	return nil
+}
+
+// flagValue records a flag so it can be applied after the file and env vars.
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string   { return f.value }
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+func (f *flagValue) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func readConfigFile(j *jsonConfig, path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigFile
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(j); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to decode config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+		u.Host != ""
+}
+
+func isIPOrCIDR(raw string) bool {
+	if net.ParseIP(raw) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(raw)
+	return err == nil
+}
+
+func (j *jsonConfig) validate() []string {
+	var problems []string
+	if j.APIKey == "" {
+		problems = append(problems, "api_key: is required")
+	}
+	if j.BindingPort < 1 || j.BindingPort > 65535 {
+		problems = append(problems, fmt.Sprintf(
+			"binding_port: %d is not between 1 and 65535", j.BindingPort,
+		))
+	}
+	if !isHTTPURL(j.APIEndpoint) {
+		problems = append(problems, fmt.Sprintf(
+			"api_endpoint: %q is not an http(s) URL", j.APIEndpoint,
+		))
+	}
+
+	if j.DDBEndpoint != "" && !isHTTPURL(j.DDBEndpoint) {
+		problems = append(problems, fmt.Sprintf(
+			"ddb_endpoint: %q is not an http(s) URL", j.DDBEndpoint,
+		))
+	}
+	if j.DDBRegion == "" {
+		problems = append(problems, "ddb_region: is required")
+	}
+	if (j.DDBAccessKeyID == "") != (j.DDBSecretAccessKey == "") {
+		problems = append(problems, "ddb_access_key_id, ddb_secret_access_key: "+
+			"must be set together")
+	}
+
+	if _, err := logrus.ParseLevel(j.LogLevel); err != nil {
+		problems = append(problems, fmt.Sprintf(
+			"log_level: %q is not a log level", j.LogLevel,
+		))
+	}
+	if j.LogFormat != "text" && j.LogFormat != "json" {
+		problems = append(problems, fmt.Sprintf(
+			"log_format: %q must be text or json", j.LogFormat,
+		))
+	}
+	for _, output := range splitList(j.LogOutputs) {
+		switch output {
+		case "stdout", "stderr":
+		case "file":
+			if j.LogFile == "" {
+				problems = append(problems, "log_file: is required with file output")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf(
+				"log_outputs: %q must be stdout, stderr or file", output,
+			))
+		}
+	}
+
+	switch j.TraceExporter {
+	case "none", "stdout", "otlp":
+	default:
+		problems = append(problems, fmt.Sprintf(
+			"trace_exporter: %q must be none, stdout or otlp", j.TraceExporter,
+		))
+	}
+	if j.TraceEndpoint != "" && !isHTTPURL(j.TraceEndpoint) {
+		problems = append(problems, fmt.Sprintf(
+			"trace_endpoint: %q is not an http(s) URL", j.TraceEndpoint,
+		))
+	}
+
+	for _, origin := range splitList(j.CORSOrigins) {
+		if origin != "*" && !isHTTPURL(origin) {
+			problems = append(problems, fmt.Sprintf(
+				"cors_origins: %q is not * or an http(s) origin", origin,
+			))
+		}
+	}
+	for _, proxy := range splitList(j.TrustedProxies) {
+		if !isIPOrCIDR(proxy) {
+			problems = append(problems, fmt.Sprintf(
+				"trusted_proxies: %q is not an IP or CIDR", proxy,
+			))
+		}
+	}
+	if j.StationCacheTTLSec < 0 {
+		problems = append(problems, "station_cache_ttl_sec: must not be negative")
+	}
+	if j.TrainRetentionDays < 0 {
+		problems = append(problems, "train_retention_days: must not be negative")
+	}
+	if j.StationRefreshHours < 0 {
+		problems = append(problems, "station_refresh_hours: must not be negative")
+	}
+	if j.HistoryRetentionDays < 0 {
+		problems = append(problems, "history_retention_days: must not be negative")
+	}
+	limits := []struct {
+		name       string
+		rps, burst int
+	}{
+		{"rate_limit_ip", j.RateLimitIPRPS, j.RateLimitIPBurst},
+		{"rate_limit_key", j.RateLimitKeyRPS, j.RateLimitKeyBurst},
+	}
+	for _, limit := range limits {
+		if limit.rps < 0 {
+			problems = append(problems, fmt.Sprintf(
+				"%s_rps: must not be negative", limit.name,
+			))
+		}
+		if limit.rps > 0 && limit.burst <= 0 {
+			problems = append(problems, fmt.Sprintf(
+				"%s_burst: must be greater than 0 when %s_rps is set",
+				limit.name, limit.name,
+			))
+		}
+	}
+
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"train_route", j.TrainRoute},
+		{"station_route", j.StationRoute},
+		{"station_timing_route", j.StationTimingRoute},
+		{"line_route", j.LineRoute},
+		{"path_route", j.PathRoute},
+		{"station_table", j.StationTable},
+		{"prediction_table", j.PredictionTable},
+		{"migration_table", j.MigrationTable},
+		{"history_table", j.HistoryTable},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			problems = append(problems, field.name+": is required")
+		}
+	}
+
+	positive := []struct {
+		name  string
+		value int
+	}{
+		{"read_timeout_sec", j.ReadTimeoutSec},
+		{"write_timeout_sec", j.WriteTimeoutSec},
+		{"idle_timeout_sec", j.IdleTimeoutSec},
+		{"shutdown_timeout_sec", j.ShutdownTimeoutSec},
+		{"log_max_size_mb", j.LogMaxSizeMB},
+		{"log_max_age_days", j.LogMaxAgeDays},
+		{"log_max_backups", j.LogMaxBackups},
+		{"health_timeout_sec", j.HealthTimeoutSec},
+		{"health_max_age_sec", j.HealthMaxAgeSec},
+		{"headway_gap_minutes", j.HeadwayGapMinutes},
+		{"poll_interval_sec", j.PollIntervalSec},
+	}
+	for _, field := range positive {
+		if field.value <= 0 {
+			problems = append(problems, fmt.Sprintf(
+				"%s: must be greater than 0", field.name,
+			))
+		}
+	}
+	return problems
+}
+
+// Load builds a Configuration from defaults, then the JSON file given by
+// -config (./config.json when present otherwise), then LINETRACKER_*
+// environment variables and finally command line flags. Each setting's flag
+// and env var are named after its JSON key, e.g. binding_port can be set
+// with -binding-port or LINETRACKER_BINDING_PORT.
+// newFlagSet has a flag per JSON key of j plus -config.
+func newFlagSet(
+	j *jsonConfig,
+) (fs *flag.FlagSet, configPath *string, flags map[string]*flagValue) {
+	fs = flag.NewFlagSet("linetracker", flag.ContinueOnError)
+	configPath = fs.String(
+		"config", "", "path to a JSON config file (default ./config.json)",
+	)
+	flags = make(map[string]*flagValue)
+	jsonFields(j, func(name string, field reflect.Value) {
+		value := &flagValue{isBool: field.Kind() == reflect.Bool}
+		flags[name] = value
+		fs.Var(value, strings.ReplaceAll(name, "_", "-"), fmt.Sprintf(
+			"overrides %s, also settable with %s", name,
+			envPrefix+strings.ToUpper(name),
+		))
+	})
+	return fs, configPath, flags
+}
+
+// SplitArgs separates the config flags at the front of args from what
+// follows them, so a flag's value is never mistaken for a command.
+func SplitArgs(args []string) (configArgs []string, rest []string, err error) {
+	j := defaultJSONConfig()
+	fs, _, _ := newFlagSet(&j)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	rest = fs.Args()
+	return args[:len(args)-len(rest)], rest, nil
+}
+
+func Load(
+	args []string, lookupEnv func(string) (string, bool),
+) (*Configuration, error) {
+	j := defaultJSONConfig()
+
+	fs, configPath, flags := newFlagSet(&j)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := readConfigFile(&j, *configPath); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	jsonFields(&j, func(name string, field reflect.Value) {
+		envName := envPrefix + strings.ToUpper(name)
+		value, ok := lookupEnv(envName)
+		if !ok {
+			return
+		}
+		if err := setField(field, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", envName, err))
+		}
+	})
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	jsonFields(&j, func(name string, field reflect.Value) {
+		flagName := strings.ReplaceAll(name, "_", "-")
+		if !set[flagName] {
+			return
+		}
+		if err := setField(field, flags[name].value); err != nil {
+			problems = append(problems, fmt.Sprintf("-%s: %v", flagName, err))
+		}
+	})
+
+	j.applyModeDefaults()
+	problems = append(problems, j.validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	result := j.toConfiguration()
+	return &result, nil
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envFrom(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayersFileEnvAndFlags(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"api_key": "from-file",
+		"binding_port": 9000,
+		"admin_token": "file-token"
+	}`)
+
+	env := envFrom(map[string]string{
+		"LINETRACKER_BINDING_PORT": "9100",
+		"LINETRACKER_ADMIN_TOKEN":  "env-token",
+	})
+
+	c, err := Load([]string{
+		"-config", path, "-admin-token", "flag-token", "-prod",
+	}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.APIKey != "from-file" {
+		t.Errorf("expected api key from file, got %q", c.APIKey)
+	}
+	if c.BindingPort != 9100 {
+		t.Errorf("expected binding port from env, got %d", c.BindingPort)
+	}
+	if c.AdminToken != "flag-token" {
+		t.Errorf("expected admin token from flag, got %q", c.AdminToken)
+	}
+	if !c.IsProd {
+		t.Error("expected prod from flag")
+	}
+	if c.ShutdownTimeout != 30*time.Second {
+		t.Errorf("expected default shutdown timeout, got %s", c.ShutdownTimeout)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	path := writeConfigFile(t, "{}")
+
+	c, err := Load([]string{"-config", path}, envFrom(map[string]string{
+		"LINETRACKER_API_KEY": "from-env",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GetTrainAPI() !=
+		"https://api.wmata.com/StationPrediction.svc/json/GetPrediction/All" {
+		t.Errorf("unexpected default train API %q", c.GetTrainAPI())
+	}
+	if len(c.CORSOrigins) != 0 {
+		t.Errorf("expected no CORS origins by default, got %v", c.CORSOrigins)
+	}
+}
+
+func TestLoadMissingExplicitFile(t *testing.T) {
+	_, err := Load([]string{"-config", "does-not-exist.json"}, envFrom(nil))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+}
+
+func TestLoadReportsEveryBadField(t *testing.T) {
+	path := writeConfigFile(t, "{}")
+
+	_, err := Load([]string{
+		"-config", path, "-binding-port", "0",
+	}, envFrom(map[string]string{
+		"LINETRACKER_PROD":                   "maybe",
+		"LINETRACKER_API_ENDPOINT":           "not a url",
+		"LINETRACKER_CORS_ORIGINS":           "*,example.com",
+		"LINETRACKER_RATE_LIMIT_IP_RPS":      "-1",
+		"LINETRACKER_TRUSTED_PROXIES":        "proxy",
+		"LINETRACKER_TRAIN_RETENTION_DAYS":   "-1",
+		"LINETRACKER_HISTORY_RETENTION_DAYS": "-1",
+		"LINETRACKER_HEADWAY_GAP_MINUTES":    "0",
+		"LINETRACKER_POLL_INTERVAL_SEC":      "0",
+		"LINETRACKER_STATION_REFRESH_HOURS":  "-1",
+	}))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	for _, field := range []string{
+		"LINETRACKER_PROD", "api_key", "binding_port", "api_endpoint",
+		"cors_origins", "rate_limit_ip_rps", "trusted_proxies",
+		"train_retention_days", "history_retention_days", "headway_gap_minutes",
+		"poll_interval_sec", "station_refresh_hours",
+	} {
+		found := false
+		for _, problem := range validationErr.Problems {
+			if strings.HasPrefix(problem, field) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a problem for %s in %v", field, validationErr.Problems)
+		}
+	}
+}
+
+func TestLoadDDBModeDefaults(t *testing.T) {
+	path := writeConfigFile(t, `{"api_key": "key", "table_prefix": "dev-"}`)
+
+	local, err := Load([]string{"-config", path}, envFrom(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.DDBEndpoint != localDDBEndpoint || local.DDBAccessKeyID != localDDBKey {
+		t.Errorf("expected DynamoDB Local outside prod, got %q %q",
+			local.DDBEndpoint, local.DDBAccessKeyID)
+	}
+	if *local.StationTableName() != "dev-stations" {
+		t.Errorf("expected prefixed table, got %q", *local.StationTableName())
+	}
+
+	prod, err := Load([]string{"-config", path, "-prod"}, envFrom(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.DDBEndpoint != "" || prod.DDBAccessKeyID != "" {
+		t.Errorf("expected AWS defaults in prod, got %q %q",
+			prod.DDBEndpoint, prod.DDBAccessKeyID)
+	}
+}
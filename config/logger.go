@@ -1,35 +1,82 @@
 package config
 
 import (
+	"context"
 	"io"
 	"os"
-	"sync"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var (
-	log  *logrus.Logger
-	once sync.Once
-)
+type requestIDKey struct{}
+
+// ContextWithRequestID stores the request ID so every log entry made with the
+// returned context carries it.
+func ContextWithRequestID(
+	ctx context.Context, requestID string,
+) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// requestIDHook adds the request ID and trace ID to entries logged with
+// WithContext.
+type requestIDHook struct{}
 
-func GetLogger() *logrus.Logger {
-	isProd := config.IsProd
-	once.Do(func() {
-		log = logrus.New()
-		if isProd {
-			file, err := os.OpenFile(
-				"logs/app.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o666,
-			)
-			if err != nil {
-				logrus.Fatal(err)
-			}
-			log.SetOutput(io.MultiWriter(file, os.Stdout))
+func (requestIDHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (requestIDHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if requestID := RequestIDFromContext(entry.Context); requestID != "" {
+		entry.Data["request_id"] = requestID
+	}
+	if span := trace.SpanContextFromContext(entry.Context); span.IsValid() {
+		entry.Data["trace_id"] = span.TraceID().String()
+	}
+	return nil
+}
+
+// NewLogger builds the application logger from the log_* settings, file
+// output is rotated by size and age.
+func NewLogger(c *Configuration) *logrus.Logger {
+	log := logrus.New()
+
+	writers := make([]io.Writer, 0, len(c.LogOutputs))
+	for _, output := range c.LogOutputs {
+		switch output {
+		case "stdout":
+			writers = append(writers, os.Stdout)
+		case "stderr":
+			writers = append(writers, os.Stderr)
+		case "file":
+			// Creates the log directory on first write.
+			writers = append(writers, &lumberjack.Logger{
+				Filename:   c.LogFile,
+				MaxSize:    c.LogMaxSizeMB,
+				MaxAge:     c.LogMaxAgeDays,
+				MaxBackups: c.LogMaxBackups,
+			})
 		}
-		// log.SetReportCaller(true)
-		log.SetOutput(os.Stdout)
+	}
+	log.SetOutput(io.MultiWriter(writers...))
+
+	if c.LogFormat == "json" {
+		log.SetFormatter(&logrus.JSONFormatter{})
+	} else {
 		log.SetFormatter(&logrus.TextFormatter{})
-		log.SetLevel(logrus.DebugLevel)
-	})
+	}
+	// log.SetReportCaller(true)
+	log.SetLevel(c.LogLevel)
+	log.AddHook(requestIDHook{})
 	return log
 }
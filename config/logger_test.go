@@ -0,0 +1,32 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLoggerAddsRequestID(t *testing.T) {
+	log := NewLogger(&Configuration{
+		LogLevel:   logrus.InfoLevel,
+		LogFormat:  "json",
+		LogOutputs: []string{"stdout"},
+	})
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+
+	ctx := ContextWithRequestID(context.Background(), "req-1")
+	log.WithContext(ctx).Info("hello")
+	log.Debug("filtered by level")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON entry, got %q: %v", buf.String(), err)
+	}
+	if entry["request_id"] != "req-1" {
+		t.Errorf("expected request_id field, got %v", entry)
+	}
+}
@@ -0,0 +1,27 @@
+// Package api holds the types served under /api/v1. They are converted from
+// the storage models so the DDB schema can change without breaking clients,
+// fields may be added but are never renamed or removed within a version.
+package api
+
+// ListResponse wraps every list endpoint's response.
+type ListResponse[T any] struct {
+	Data []T      `json:"data"`
+	Meta ListMeta `json:"meta"`
+}
+
+type ListMeta struct {
+	Count int `json:"count"`
+	// Set while more pages remain, pass it back as the cursor parameter.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewListResponse wraps data, never encoding a nil slice as null.
+func NewListResponse[T any](data []T, nextCursor string) ListResponse[T] {
+	if data == nil {
+		data = []T{}
+	}
+	return ListResponse[T]{
+		Data: data,
+		Meta: ListMeta{Count: len(data), NextCursor: nextCursor},
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/reww406/linetracker/internal/station"
+	"github.com/reww406/linetracker/internal/train"
+)
+
+func TestNewStationUsesSnakeCaseAndEmptyLists(t *testing.T) {
+	data, err := json.Marshal(NewListResponse(NewStations([]station.StationModel{{
+		Code: "A01",
+		Name: "Metro Center",
+		City: "Washington",
+		StationSchedule: []station.StationSchedule{
+			{Day: "Monday", OpeningTime: "05:00", LastTrain: "00:12"},
+		},
+	}}), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"data":[{"code":"A01","name":"Metro Center",` +
+		`"address":{"street":"","city":"Washington","state":"","zip":""},` +
+		`"latitude":0,"longitude":0,"line_codes":[],"destinations":[],` +
+		`"schedule":[{"day":"Monday","opening_time":"05:00","last_train":"00:12"}]}],` +
+		`"meta":{"count":1}}`
+	if string(data) != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, data)
+	}
+}
+
+func TestNewTrainConvertsObservedAt(t *testing.T) {
+	got := NewTrain(train.TrainModel{
+		LineCode:       "RD",
+		Minutes:        3,
+		CreatedEpochMs: 1700000000000,
+	})
+	if got.ObservedAt.UnixMilli() != 1700000000000 || got.Minutes != 3 {
+		t.Errorf("unexpected conversion %+v", got)
+	}
+
+	data, _ := json.Marshal(NewListResponse[Train](nil, ""))
+	if string(data) != `{"data":[],"meta":{"count":0}}` {
+		t.Errorf("expected an empty list, got %s", data)
+	}
+}
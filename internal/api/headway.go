@@ -0,0 +1,73 @@
+package api
+
+import (
+	"time"
+
+	"github.com/reww406/linetracker/internal/headway"
+)
+
+// HeadwayStats are headways in seconds.
+type HeadwayStats struct {
+	Min  int `json:"min"`
+	P50  int `json:"p50"`
+	P90  int `json:"p90"`
+	P95  int `json:"p95"`
+	Max  int `json:"max"`
+	Mean int `json:"mean"`
+}
+
+type Gap struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Seconds int       `json:"seconds"`
+}
+
+// Headway is the observed service in one direction of a line at a station.
+type Headway struct {
+	LocationCode   string       `json:"location_code"`
+	LineCode       string       `json:"line_code"`
+	Group          string       `json:"group"`
+	From           time.Time    `json:"from"`
+	To             time.Time    `json:"to"`
+	Trains         int          `json:"trains"`
+	Headways       int          `json:"headways"`
+	HeadwaySeconds HeadwayStats `json:"headway_seconds"`
+	Gaps           []Gap        `json:"gaps"`
+}
+
+func seconds(d time.Duration) int {
+	return int(d.Round(time.Second).Seconds())
+}
+
+func NewHeadways(result headway.Result) []Headway {
+	headways := make([]Headway, len(result.Reports))
+	for i, r := range result.Reports {
+		gaps := make([]Gap, len(r.Gaps))
+		for j, g := range r.Gaps {
+			gaps[j] = Gap{
+				From:    g.From.UTC(),
+				To:      g.To.UTC(),
+				Seconds: seconds(g.Duration()),
+			}
+		}
+		headways[i] = Headway{
+			LocationCode: r.LocationCode,
+			LineCode:     r.LineCode,
+			Group:        r.Group,
+			From:         result.From.UTC(),
+			To:           result.To.UTC(),
+			Trains:       r.Trains,
+			Headways:     r.Headways,
+			HeadwaySeconds: HeadwayStats{
+				Min:  seconds(r.Min),
+				P50:  seconds(r.P50),
+				P90:  seconds(r.P90),
+				P95:  seconds(r.P95),
+				Max:  seconds(r.Max),
+				Mean: seconds(r.Mean),
+			},
+			Gaps: gaps,
+		}
+	}
+	return headways
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"time"
+
+	"github.com/reww406/linetracker/internal/history"
+)
+
+// Snapshot is a station's predictions from one poll.
+type Snapshot struct {
+	LocationCode string    `json:"location_code"`
+	ObservedAt   time.Time `json:"observed_at"`
+	Trains       []Train   `json:"trains"`
+}
+
+func NewSnapshot(s history.Snapshot) Snapshot {
+	return Snapshot{
+		LocationCode: s.LocationCode,
+		ObservedAt:   time.UnixMilli(s.PolledEpochMs).UTC(),
+		Trains:       NewTrains(s.Trains),
+	}
+}
+
+func NewSnapshots(snapshots []history.Snapshot) []Snapshot {
+	result := make([]Snapshot, len(snapshots))
+	for i, s := range snapshots {
+		result[i] = NewSnapshot(s)
+	}
+	return result
+}
@@ -0,0 +1,20 @@
+package api
+
+import "github.com/reww406/linetracker/internal/metro"
+
+type Line struct {
+	Code metro.LineCode `json:"code"`
+	Name string         `json:"name"`
+}
+
+// Lines lists every line in the system.
+func Lines() []Line {
+	return []Line{
+		{Code: metro.SilverLine, Name: "Silver"},
+		{Code: metro.OrangeLine, Name: "Orange"},
+		{Code: metro.BlueLine, Name: "Blue"},
+		{Code: metro.RedLine, Name: "Red"},
+		{Code: metro.GreenLine, Name: "Green"},
+		{Code: metro.YellowLine, Name: "Yellow"},
+	}
+}
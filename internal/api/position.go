@@ -0,0 +1,45 @@
+package api
+
+import (
+	"time"
+
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/tracker"
+)
+
+// Position is where a train is estimated to be on its line.
+type Position struct {
+	RunID               string         `json:"run_id"`
+	LineCode            metro.LineCode `json:"line_code"`
+	DestinationCode     string         `json:"destination_code"`
+	DestinationName     string         `json:"destination_name"`
+	Group               string         `json:"group"`
+	CarCount            int8           `json:"car_count"`
+	PreviousStationCode string         `json:"previous_station_code,omitempty"`
+	NextStationCode     string         `json:"next_station_code"`
+	NextStationName     string         `json:"next_station_name"`
+	Minutes             int8           `json:"minutes"`
+	FirstSeen           time.Time      `json:"first_seen"`
+	ObservedAt          time.Time      `json:"observed_at"`
+}
+
+func NewPositions(positions []tracker.Position) []Position {
+	result := make([]Position, len(positions))
+	for i, p := range positions {
+		result[i] = Position{
+			RunID:               p.RunID,
+			LineCode:            p.LineCode,
+			DestinationCode:     p.DestinationCode,
+			DestinationName:     p.DestinationName,
+			Group:               p.Group,
+			CarCount:            p.CarCount,
+			PreviousStationCode: p.PreviousStationCode,
+			NextStationCode:     p.NextStationCode,
+			NextStationName:     p.NextStationName,
+			Minutes:             p.Minutes,
+			FirstSeen:           p.FirstSeen.UTC(),
+			ObservedAt:          p.ObservedAt.UTC(),
+		}
+	}
+	return result
+}
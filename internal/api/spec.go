@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var (
+	//go:embed openapi.json
+	specJSON []byte
+	//go:embed docs.html
+	docsHTML []byte
+)
+
+// SpecJSON is the OpenAPI document served at /api/v1/openapi.json.
+func SpecJSON() []byte {
+	return specJSON
+}
+
+// DocsHTML is a self contained page rendering the OpenAPI document.
+func DocsHTML() []byte {
+	return docsHTML
+}
+
+// LoadSpec parses and validates the OpenAPI document.
+func LoadSpec(ctx context.Context) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(specJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec: %w", err)
+	}
+	if err := doc.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	return doc, nil
+}
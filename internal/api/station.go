@@ -0,0 +1,75 @@
+package api
+
+import (
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/station"
+)
+
+type Address struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+	State  string `json:"state"`
+	Zip    string `json:"zip"`
+}
+
+type StationSchedule struct {
+	Day         string `json:"day"`
+	OpeningTime string `json:"opening_time"`
+	LastTrain   string `json:"last_train"`
+}
+
+type Station struct {
+	Code      string           `json:"code"`
+	Name      string           `json:"name"`
+	Address   Address          `json:"address"`
+	Latitude  float32          `json:"latitude"`
+	Longitude float32          `json:"longitude"`
+	LineCodes []metro.LineCode `json:"line_codes"`
+	// Codes of the stations trains from here terminate at.
+	Destinations []string          `json:"destinations"`
+	Schedule     []StationSchedule `json:"schedule"`
+}
+
+func NewStation(m station.StationModel) Station {
+	schedule := make([]StationSchedule, len(m.StationSchedule))
+	for i, day := range m.StationSchedule {
+		schedule[i] = StationSchedule{
+			Day:         day.Day,
+			OpeningTime: day.OpeningTime,
+			LastTrain:   day.LastTrain,
+		}
+	}
+
+	lineCodes := m.LineCodes
+	if lineCodes == nil {
+		lineCodes = []metro.LineCode{}
+	}
+	destinations := m.Destinations
+	if destinations == nil {
+		destinations = []string{}
+	}
+
+	return Station{
+		Code: m.Code,
+		Name: m.Name,
+		Address: Address{
+			Street: m.Street,
+			City:   m.City,
+			State:  m.State,
+			Zip:    m.Zip,
+		},
+		Latitude:     m.Latitude,
+		Longitude:    m.Longitude,
+		LineCodes:    lineCodes,
+		Destinations: destinations,
+		Schedule:     schedule,
+	}
+}
+
+func NewStations(models []station.StationModel) []Station {
+	result := make([]Station, len(models))
+	for i, m := range models {
+		result[i] = NewStation(m)
+	}
+	return result
+}
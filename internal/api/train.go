@@ -0,0 +1,48 @@
+package api
+
+import (
+	"time"
+
+	"github.com/reww406/linetracker/internal/train"
+)
+
+// Train is one arrival prediction for a station.
+type Train struct {
+	LineCode        string `json:"line_code"`
+	LocationCode    string `json:"location_code"`
+	LocationName    string `json:"location_name"`
+	Destination     string `json:"destination"`
+	DestinationCode string `json:"destination_code"`
+	DestinationName string `json:"destination_name"`
+	// Track group, 1 or 2, which identifies the direction at the station.
+	Group    string `json:"group"`
+	CarCount int    `json:"car_count"`
+	// Minutes until arrival, 0 when arriving or boarding and -1 when WMATA
+	// has no estimate.
+	Minutes int `json:"minutes"`
+	// When the prediction was fetched from WMATA.
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+func NewTrain(m train.TrainModel) Train {
+	return Train{
+		LineCode:        m.LineCode,
+		LocationCode:    m.LocationCode,
+		LocationName:    m.LocationName,
+		Destination:     m.Destination,
+		DestinationCode: m.DestinationCode,
+		DestinationName: m.DestinationName,
+		Group:           m.Group,
+		CarCount:        int(m.CarCount),
+		Minutes:         int(m.Minutes),
+		ObservedAt:      time.UnixMilli(m.CreatedEpochMs).UTC(),
+	}
+}
+
+func NewTrains(models []train.TrainModel) []Train {
+	result := make([]Train, len(models))
+	for i, m := range models {
+		result[i] = NewTrain(m)
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+// Package apperror defines the error kinds the API reports to clients. The
+// message is safe to show callers, the wrapped cause is only logged.
+package apperror
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Code string
+
+const (
+	CodeInvalidArgument     Code = "invalid_argument"
+	CodeUnauthenticated     Code = "unauthenticated"
+	CodeNotFound            Code = "not_found"
+	CodeConflict            Code = "conflict"
+	CodeRateLimited         Code = "rate_limited"
+	CodeUpstreamUnavailable Code = "upstream_unavailable"
+	CodeStoreFailure        Code = "store_failure"
+	CodeUnavailable         Code = "unavailable"
+	CodeInternal            Code = "internal"
+)
+
+type Error struct {
+	Code    Code
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(code Code, message string, cause error) *Error {
+	return &Error{Code: code, Message: message, Err: cause}
+}
+
+func InvalidArgument(message string) *Error {
+	return New(CodeInvalidArgument, message, nil)
+}
+
+func NotFound(message string) *Error {
+	return New(CodeNotFound, message, nil)
+}
+
+// Upstream wraps a failed call to the WMATA API.
+func Upstream(message string, cause error) *Error {
+	return New(CodeUpstreamUnavailable, message, cause)
+}
+
+// Store wraps a failed DDB operation.
+func Store(message string, cause error) *Error {
+	return New(CodeStoreFailure, message, cause)
+}
+
+// CodeOf returns the code of the outermost *Error in err's chain, internal
+// when there is none.
+func CodeOf(err error) Code {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return CodeInternal
+}
+
+// MessageOf returns the client safe message of the outermost *Error in err's
+// chain.
+func MessageOf(err error) string {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Message
+	}
+	return "internal error"
+}
@@ -0,0 +1,32 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCodeAndMessageSurviveWrapping(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("failed to list stations: %w", Store("failed to scan stations table", cause))
+
+	if got := CodeOf(err); got != CodeStoreFailure {
+		t.Errorf("expected %s, got %s", CodeStoreFailure, got)
+	}
+	if got := MessageOf(err); got != "failed to scan stations table" {
+		t.Errorf("unexpected message %q", got)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("expected the cause to be reachable with errors.Is")
+	}
+}
+
+func TestUntypedErrorsAreInternal(t *testing.T) {
+	err := errors.New("boom")
+	if got := CodeOf(err); got != CodeInternal {
+		t.Errorf("expected %s, got %s", CodeInternal, got)
+	}
+	if got := MessageOf(err); got != "internal error" {
+		t.Errorf("expected the cause to be hidden, got %q", got)
+	}
+}
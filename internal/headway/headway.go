@@ -0,0 +1,165 @@
+// Package headway measures the time between trains, and the gaps in
+// service, from the archived predictions in the history table.
+package headway
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/history"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/station"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultRange = 3 * time.Hour
+	// Longest window for one station.
+	MaxRange = 7 * 24 * time.Hour
+	// Longest window when every station on a line is read.
+	MaxLineRange = 24 * time.Hour
+)
+
+// Request selects a station, every station on a line or a line at a
+// station, between From and To. To defaults to now and From to DefaultRange
+// before To.
+type Request struct {
+	LocationCode string
+	LineCode     metro.LineCode
+	From         time.Time
+	To           time.Time
+}
+
+type Result struct {
+	From    time.Time
+	To      time.Time
+	Reports []Report
+}
+
+type Service struct {
+	history      *history.Repository
+	stations     *station.Repository
+	log          *logrus.Logger
+	gapThreshold time.Duration
+}
+
+func NewService(
+	historyRepo *history.Repository,
+	stations *station.Repository,
+	c *config.Configuration,
+	log *logrus.Logger,
+) *Service {
+	return &Service{
+		history:      historyRepo,
+		stations:     stations,
+		log:          log,
+		gapThreshold: c.HeadwayGapThreshold,
+	}
+}
+
+func (req *Request) validate() error {
+	if req.LocationCode == "" && req.LineCode == "" {
+		return apperror.InvalidArgument("location_code or line_code is required")
+	}
+	if !req.From.Before(req.To) {
+		return apperror.InvalidArgument("from must be before to")
+	}
+	maxRange := MaxRange
+	if req.LocationCode == "" {
+		maxRange = MaxLineRange
+	}
+	if req.To.Sub(req.From) > maxRange {
+		return apperror.InvalidArgument(fmt.Sprintf(
+			"from and to must be at most %d hours apart", int(maxRange.Hours()),
+		))
+	}
+	return nil
+}
+
+// locationCodes is the requested station or every station on the line.
+func (s *Service) locationCodes(
+	ctx context.Context, req Request,
+) ([]string, error) {
+	if req.LocationCode != "" {
+		return []string{req.LocationCode}, nil
+	}
+	stations, err := s.stations.ListStations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, st := range stations {
+		if slices.Contains(st.LineCodes, req.LineCode) {
+			result = append(result, st.Code)
+		}
+	}
+	if len(result) == 0 {
+		return nil, apperror.NotFound(fmt.Sprintf(
+			"no stations on line code: %s", req.LineCode,
+		))
+	}
+	return result, nil
+}
+
+// snapshots reads every archived snapshot of a station in the window.
+func (s *Service) snapshots(
+	ctx context.Context, locationCode string, from, to time.Time,
+) ([]history.Snapshot, error) {
+	request := history.Request{
+		LocationCode: locationCode,
+		From:         from,
+		To:           to,
+		Limit:        history.MaxLimit,
+	}
+	var result []history.Snapshot
+	for {
+		page, err := s.history.GetSnapshots(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, page.Snapshots...)
+		if page.NextCursor == "" {
+			return result, nil
+		}
+		request.Cursor = page.NextCursor
+	}
+}
+
+// GetHeadways reports the observed headways of every direction of travel
+// at the requested stations.
+func (s *Service) GetHeadways(ctx context.Context, req Request) (Result, error) {
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.From.IsZero() {
+		req.From = req.To.Add(-DefaultRange)
+	}
+	if err := req.validate(); err != nil {
+		return Result{}, err
+	}
+
+	locationCodes, err := s.locationCodes(ctx, req)
+	if err != nil {
+		return Result{}, err
+	}
+	var all []Arrival
+	for _, locationCode := range locationCodes {
+		snapshots, err := s.snapshots(ctx, locationCode, req.From, req.To)
+		if err != nil {
+			return Result{}, err
+		}
+		all = append(all, arrivals(snapshots, req.LineCode)...)
+	}
+
+	reports := summarize(all, s.gapThreshold)
+	s.log.WithContext(ctx).WithFields(logrus.Fields{
+		"location_code": req.LocationCode,
+		"line_code":     req.LineCode,
+		"result_len":    len(reports),
+	}).Info("headways computed.")
+	return Result{From: req.From, To: req.To, Reports: reports}, nil
+}
@@ -0,0 +1,200 @@
+package headway
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/reww406/linetracker/internal/history"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/train"
+)
+
+// maxPollGap is the longest two snapshots may be apart and still be
+// compared. Longer gaps are outages or the poller's overnight pause, no
+// headway is measured across them.
+const maxPollGap = 5 * time.Minute
+
+// key is a direction of travel on a line at a station, WMATA's Group is the
+// track a train leaves on.
+type key struct {
+	LocationCode string
+	LineCode     string
+	Group        string
+}
+
+// Arrival is a train leaving a station, estimated from the snapshot before
+// its prediction disappeared.
+type Arrival struct {
+	key
+	At time.Time
+	// Arrivals are only compared within the same unbroken run of polls.
+	run int
+}
+
+type lead struct {
+	minutes int8
+	polled  time.Time
+}
+
+func (l lead) at() time.Time {
+	return l.polled.Add(time.Duration(l.minutes) * time.Minute)
+}
+
+// leads is the nearest train per direction in one snapshot, UnknownMinutes
+// when none of its trains have an estimate.
+func leads(snapshot history.Snapshot, lineCode metro.LineCode) map[key]int8 {
+	result := map[key]int8{}
+	for _, t := range snapshot.Trains {
+		if t.LineCode == "" || t.Group == "" ||
+			(lineCode != "" && t.LineCode != string(lineCode)) {
+			continue
+		}
+		k := key{snapshot.LocationCode, t.LineCode, t.Group}
+		minutes, ok := result[k]
+		if t.Minutes == train.UnknownMinutes {
+			if !ok {
+				result[k] = t.Minutes
+			}
+			continue
+		}
+		if !ok || minutes == train.UnknownMinutes || t.Minutes < minutes {
+			result[k] = t.Minutes
+		}
+	}
+	return result
+}
+
+// arrivals follows the nearest train in every direction across snapshots in
+// polling order. A train due within a minute has left once the next train's
+// prediction is more than a minute later than its own, smaller jumps are
+// prediction noise, or once nothing is predicted after it. Jumps of trains
+// further out are delays. Directions without an estimate are skipped until
+// one returns.
+func arrivals(snapshots []history.Snapshot, lineCode metro.LineCode) []Arrival {
+	var result []Arrival
+	previous := map[key]lead{}
+	run := 0
+	var lastPolled time.Time
+	for _, snapshot := range snapshots {
+		polled := time.UnixMilli(snapshot.PolledEpochMs)
+		if !lastPolled.IsZero() && polled.Sub(lastPolled) > maxPollGap {
+			previous = map[key]lead{}
+			run++
+		}
+		lastPolled = polled
+
+		current := leads(snapshot, lineCode)
+		for k, prev := range previous {
+			minutes, ok := current[k]
+			if minutes == train.UnknownMinutes {
+				continue
+			}
+			if prev.minutes <= 1 && (!ok || minutes > prev.minutes+1) {
+				result = append(result, Arrival{key: k, At: prev.at(), run: run})
+			}
+			if !ok {
+				delete(previous, k)
+			}
+		}
+		for k, minutes := range current {
+			if minutes != train.UnknownMinutes {
+				previous[k] = lead{minutes: minutes, polled: polled}
+			}
+		}
+	}
+	return result
+}
+
+// Gap is a headway longer than the configured threshold.
+type Gap struct {
+	From time.Time
+	To   time.Time
+}
+
+func (g Gap) Duration() time.Duration {
+	return g.To.Sub(g.From)
+}
+
+// Report is the observed service in one direction of a line at a station.
+type Report struct {
+	LocationCode string
+	LineCode     string
+	Group        string
+	// Trains that left the station in the window.
+	Trains int
+	// Headways measured, fewer than Trains when polling was interrupted.
+	Headways int
+	Min      time.Duration
+	P50      time.Duration
+	P90      time.Duration
+	P95      time.Duration
+	Max      time.Duration
+	Mean     time.Duration
+	Gaps     []Gap
+}
+
+// percentile uses the nearest rank of sorted, which must not be empty.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+// summarize groups arrivals by direction and reports the time between
+// consecutive ones, sorted by station, line and group.
+func summarize(all []Arrival, gapThreshold time.Duration) []Report {
+	byKey := map[key][]Arrival{}
+	for _, arrival := range all {
+		byKey[arrival.key] = append(byKey[arrival.key], arrival)
+	}
+
+	result := make([]Report, 0, len(byKey))
+	for k, keyArrivals := range byKey {
+		sort.SliceStable(keyArrivals, func(i, j int) bool {
+			return keyArrivals[i].At.Before(keyArrivals[j].At)
+		})
+		report := Report{
+			LocationCode: k.LocationCode,
+			LineCode:     k.LineCode,
+			Group:        k.Group,
+			Trains:       len(keyArrivals),
+		}
+		var headways []time.Duration
+		var total time.Duration
+		for i := 1; i < len(keyArrivals); i++ {
+			prev, cur := keyArrivals[i-1], keyArrivals[i]
+			if prev.run != cur.run {
+				continue
+			}
+			headway := cur.At.Sub(prev.At)
+			headways = append(headways, headway)
+			total += headway
+			if headway > gapThreshold {
+				report.Gaps = append(report.Gaps, Gap{From: prev.At, To: cur.At})
+			}
+		}
+		if len(headways) > 0 {
+			sort.Slice(headways, func(i, j int) bool { return headways[i] < headways[j] })
+			report.Headways = len(headways)
+			report.Min = headways[0]
+			report.P50 = percentile(headways, 50)
+			report.P90 = percentile(headways, 90)
+			report.P95 = percentile(headways, 95)
+			report.Max = headways[len(headways)-1]
+			report.Mean = total / time.Duration(len(headways))
+		}
+		result = append(result, report)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.LocationCode != b.LocationCode {
+			return a.LocationCode < b.LocationCode
+		}
+		if a.LineCode != b.LineCode {
+			return a.LineCode < b.LineCode
+		}
+		return a.Group < b.Group
+	})
+	return result
+}
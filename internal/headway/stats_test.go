@@ -0,0 +1,126 @@
+package headway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/reww406/linetracker/internal/history"
+	"github.com/reww406/linetracker/internal/train"
+)
+
+var start = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+// snapshot is K08's predictions polled at minute past start.
+func snapshot(minute int, trains ...train.TrainModel) history.Snapshot {
+	return history.Snapshot{
+		LocationCode:  "K08",
+		PolledEpochMs: start.Add(time.Duration(minute) * time.Minute).UnixMilli(),
+		Trains:        trains,
+	}
+}
+
+func orange(group string, minutes int8) train.TrainModel {
+	return train.TrainModel{LineCode: "OR", Group: group, Minutes: minutes}
+}
+
+func TestArrivalsFollowsNearestTrain(t *testing.T) {
+	snapshots := []history.Snapshot{
+		snapshot(0, orange("1", 2), orange("1", 8), orange("2", 4)),
+		snapshot(1, orange("1", 1), orange("1", 7), orange("2", 4)),
+		// Group 1's first train left, group 2 slipped a minute.
+		snapshot(2, orange("1", 6), orange("2", 4)),
+		snapshot(3, orange("1", 5), orange("2", 1)),
+		// Group 2 has nothing predicted after its train was due.
+		snapshot(4, orange("1", 4)),
+	}
+
+	got := arrivals(snapshots, "")
+	if len(got) != 2 {
+		t.Fatalf("expected 2 arrivals, got %+v", got)
+	}
+	want := map[string]time.Time{
+		"1": start.Add(2 * time.Minute),
+		"2": start.Add(4 * time.Minute),
+	}
+	for _, arrival := range got {
+		if !arrival.At.Equal(want[arrival.Group]) {
+			t.Errorf("group %s: expected %s, got %s",
+				arrival.Group, want[arrival.Group], arrival.At)
+		}
+	}
+
+	if got := arrivals(snapshots, "BL"); len(got) != 0 {
+		t.Errorf("expected no Blue line arrivals, got %+v", got)
+	}
+}
+
+func TestArrivalsIgnoresDelayedTrains(t *testing.T) {
+	snapshots := []history.Snapshot{
+		snapshot(0, orange("1", 5)),
+		// Held between stations, the same train is now further out.
+		snapshot(1, orange("1", 7)),
+		snapshot(2, orange("1", 6)),
+	}
+
+	if got := arrivals(snapshots, ""); len(got) != 0 {
+		t.Errorf("expected no arrivals for a delayed train, got %+v", got)
+	}
+}
+
+func TestArrivalsSkipUnknownEstimates(t *testing.T) {
+	snapshots := []history.Snapshot{
+		snapshot(0, orange("1", 3)),
+		// WMATA lost the estimate, this is not a train due now.
+		snapshot(1, orange("1", train.UnknownMinutes)),
+		snapshot(2, orange("1", 8)),
+		snapshot(3, orange("1", 1)),
+		snapshot(4, orange("1", train.UnknownMinutes), orange("1", 9)),
+	}
+
+	got := arrivals(snapshots, "")
+	if len(got) != 1 || !got[0].At.Equal(start.Add(4*time.Minute)) {
+		t.Errorf("expected only the train due at minute 4, got %+v", got)
+	}
+}
+
+func TestArrivalsRestartAfterPollGap(t *testing.T) {
+	snapshots := []history.Snapshot{
+		snapshot(0, orange("1", 1)),
+		// Polling stopped, the jump is not a departure.
+		snapshot(30, orange("1", 9)),
+		snapshot(31, orange("1", 0)),
+		snapshot(32, orange("1", 6)),
+	}
+
+	got := arrivals(snapshots, "")
+	if len(got) != 1 || !got[0].At.Equal(start.Add(31*time.Minute)) {
+		t.Errorf("expected one arrival after the gap, got %+v", got)
+	}
+}
+
+func TestSummarizeReportsPercentilesAndGaps(t *testing.T) {
+	k := key{"K08", "OR", "1"}
+	var all []Arrival
+	for _, minute := range []int{0, 6, 12, 20, 45} {
+		all = append(all, Arrival{key: k, At: start.Add(time.Duration(minute) * time.Minute)})
+	}
+	// A later run is not compared with the earlier one.
+	all = append(all, Arrival{key: k, At: start.Add(3 * time.Hour), run: 1})
+
+	got := summarize(all, 20*time.Minute)
+	if len(got) != 1 {
+		t.Fatalf("expected one report, got %+v", got)
+	}
+	report := got[0]
+	if report.Trains != 6 || report.Headways != 4 {
+		t.Errorf("expected 6 trains and 4 headways, got %+v", report)
+	}
+	if report.Min != 6*time.Minute || report.P50 != 6*time.Minute ||
+		report.P90 != 25*time.Minute || report.Max != 25*time.Minute ||
+		report.Mean != 45*time.Minute/4 {
+		t.Errorf("unexpected headways %+v", report)
+	}
+	if len(report.Gaps) != 1 || report.Gaps[0].Duration() != 25*time.Minute {
+		t.Errorf("expected one 25 minute gap, got %+v", report.Gaps)
+	}
+}
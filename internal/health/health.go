@@ -0,0 +1,114 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDisabled = "disabled"
+	// Overall status when any component fails.
+	StatusUnavailable = "unavailable"
+)
+
+// Result is the outcome of checking a single component.
+type Result struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func OK(detail string) Result {
+	return Result{Status: StatusOK, Detail: detail}
+}
+
+func Fail(err error) Result {
+	return Result{Status: StatusFail, Error: err.Error()}
+}
+
+// Disabled reports a component that is not running, it does not make the
+// service unready.
+func Disabled(detail string) Result {
+	return Result{Status: StatusDisabled, Detail: detail}
+}
+
+// Check inspects one dependency, ctx carries the per-check timeout.
+type Check func(ctx context.Context) Result
+
+type Report struct {
+	Status     string            `json:"status"`
+	Components map[string]Result `json:"components"`
+}
+
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs every registered check concurrently and combines the results.
+// Reports are reused for cacheFor so frequent probes do not each reach the
+// dependencies.
+type Checker struct {
+	timeout  time.Duration
+	cacheFor time.Duration
+	checks   map[string]Check
+
+	// Held while checking so concurrent callers share one report.
+	mu        sync.Mutex
+	last      Report
+	checkedAt time.Time
+}
+
+func NewChecker(timeout, cacheFor time.Duration) *Checker {
+	return &Checker{
+		timeout:  timeout,
+		cacheFor: cacheFor,
+		checks:   make(map[string]Check),
+	}
+}
+
+// Register must be called before the checker is used.
+func (c *Checker) Register(name string, check Check) {
+	c.checks[name] = check
+}
+
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.cacheFor {
+		return c.last
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	report := Report{
+		Status:     StatusOK,
+		Components: make(map[string]Result, len(c.checks)),
+	}
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = result
+			if result.Status == StatusFail {
+				report.Status = StatusUnavailable
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	c.last = report
+	c.checkedAt = time.Now()
+	return report
+}
@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckerReportsEveryComponent(t *testing.T) {
+	c := NewChecker(time.Second, 0)
+	c.Register("store", func(ctx context.Context) Result { return OK("") })
+	c.Register("poller", func(ctx context.Context) Result {
+		return Disabled("poller is not running")
+	})
+
+	report := c.Check(context.Background())
+	if !report.Ready() {
+		t.Fatalf("expected ready, got %+v", report)
+	}
+	if report.Components["poller"].Status != StatusDisabled {
+		t.Errorf("expected poller disabled, got %+v", report.Components["poller"])
+	}
+
+	c.Register("stations", func(ctx context.Context) Result {
+		return Fail(errors.New("stations table is empty"))
+	})
+	report = c.Check(context.Background())
+	if report.Ready() || report.Status != StatusUnavailable {
+		t.Fatalf("expected unavailable, got %+v", report)
+	}
+	if report.Components["stations"].Error != "stations table is empty" {
+		t.Errorf("expected stations error, got %+v", report.Components["stations"])
+	}
+}
+
+func TestCheckerAppliesTimeout(t *testing.T) {
+	c := NewChecker(10*time.Millisecond, 0)
+	c.Register("store", func(ctx context.Context) Result {
+		<-ctx.Done()
+		return Fail(ctx.Err())
+	})
+
+	report := c.Check(context.Background())
+	if report.Ready() {
+		t.Fatal("expected a check that times out to fail")
+	}
+}
+
+func TestCheckerReusesRecentReport(t *testing.T) {
+	c := NewChecker(time.Second, time.Hour)
+	calls := 0
+	c.Register("store", func(ctx context.Context) Result {
+		calls++
+		return OK("")
+	})
+
+	c.Check(context.Background())
+	if report := c.Check(context.Background()); !report.Ready() || calls != 1 {
+		t.Errorf("expected the cached report after one check, got %+v after %d",
+			report, calls)
+	}
+}
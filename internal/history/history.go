@@ -0,0 +1,243 @@
+// Package history archives every poll's predictions per station so they can
+// be read back long after the trains table's ten minute window.
+package history
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/train"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+	DefaultRange = time.Hour
+	// Longest from to to span one request may cover.
+	MaxRange = 31 * 24 * time.Hour
+
+	SampleFirst = "first"
+	SampleLast  = "last"
+)
+
+var ErrInvalidCursor = apperror.InvalidArgument("invalid cursor")
+
+// Snapshot is one station's predictions from one poll.
+type Snapshot struct {
+	LocationCode  string             `dynamodbav:"locationCode"`
+	PolledEpochMs int64              `dynamodbav:"polledEpochMs"`
+	Trains        []train.TrainModel `dynamodbav:"trains"`
+	// Unix seconds after which DDB's TTL deletes the item, unset when
+	// history is kept forever.
+	ExpiresAt int64 `dynamodbav:"expiresAt,omitempty"`
+}
+
+// Request selects a station's snapshots polled between From and To, the
+// last DefaultRange when they are zero. With an Interval only the first or
+// last snapshot, per Sample, of every Interval long bucket counted from From
+// is kept. Limit is DefaultLimit when 0.
+type Request struct {
+	LocationCode string
+	From         time.Time
+	To           time.Time
+	Interval     time.Duration
+	Sample       string
+	Limit        int
+	Cursor       string
+}
+
+type Page struct {
+	Snapshots []Snapshot
+	// Empty once the range is exhausted.
+	NextCursor string
+}
+
+// Repository reads and writes the history table.
+type Repository struct {
+	client    *dynamodb.Client
+	tableName *string
+	log       *logrus.Logger
+	retention time.Duration
+}
+
+func NewRepository(
+	client *dynamodb.Client, c *config.Configuration, log *logrus.Logger,
+) *Repository {
+	return &Repository{
+		client:    client,
+		tableName: c.HistoryTableName(),
+		log:       log,
+		retention: c.HistoryRetention,
+	}
+}
+
+// ArchiveSnapshot is an EventBus Handler that writes one item per station
+// in the snapshot.
+func (r *Repository) ArchiveSnapshot(
+	ctx context.Context, event train.PredictionSnapshot,
+) error {
+	polled := event.Timestamp.UnixMilli()
+	for locationCode, trains := range event.Locations {
+		snapshot := Snapshot{
+			LocationCode:  locationCode,
+			PolledEpochMs: polled,
+			Trains:        trains,
+		}
+		if r.retention > 0 {
+			snapshot.ExpiresAt = event.Timestamp.Add(r.retention).Unix()
+		}
+		item, err := attributevalue.MarshalMap(snapshot)
+		if err != nil {
+			return fmt.Errorf("failed to marshal snapshot: %w", err)
+		}
+		_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: r.tableName,
+			Item:      item,
+		})
+		if err != nil {
+			return apperror.Store(fmt.Sprintf(
+				"failed to archive snapshot for location code: %s", locationCode,
+			), err)
+		}
+	}
+	return nil
+}
+
+func (req *Request) validate() error {
+	if req.LocationCode == "" {
+		return apperror.InvalidArgument("location_code is required")
+	}
+	if !req.From.Before(req.To) {
+		return apperror.InvalidArgument("from must be before to")
+	}
+	if req.To.Sub(req.From) > MaxRange {
+		return apperror.InvalidArgument(fmt.Sprintf(
+			"from and to must be at most %d days apart", int(MaxRange.Hours()/24),
+		))
+	}
+	if req.Interval < 0 {
+		return apperror.InvalidArgument("interval must not be negative")
+	}
+	if req.Sample != SampleFirst && req.Sample != SampleLast {
+		return apperror.InvalidArgument("sample must be first or last")
+	}
+	if req.Limit < 1 || req.Limit > MaxLimit {
+		return apperror.InvalidArgument(fmt.Sprintf(
+			"limit must be between 1 and %d", MaxLimit,
+		))
+	}
+	return nil
+}
+
+// cursor is the opaque position handed to clients. It carries the range it
+// was issued for, in epoch ms, so later pages keep the same buckets even
+// when from and to were left to their defaults.
+type cursor struct {
+	From   int64 `json:"f"`
+	To     int64 `json:"t"`
+	Resume int64 `json:"r"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil ||
+		c.Resume < c.From || c.Resume > c.To {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// GetSnapshots returns up to Limit downsampled snapshots in polling order.
+func (r *Repository) GetSnapshots(
+	ctx context.Context, req Request,
+) (Page, error) {
+	if req.Limit == 0 {
+		req.Limit = DefaultLimit
+	}
+	if req.Sample == "" {
+		req.Sample = SampleFirst
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.From.IsZero() {
+		req.From = req.To.Add(-DefaultRange)
+	}
+	start := req.From.UnixMilli()
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		req.From, req.To = time.UnixMilli(c.From), time.UnixMilli(c.To)
+		start = c.Resume
+	}
+	if err := req.validate(); err != nil {
+		return Page{}, err
+	}
+
+	keyExpr := expression.Key("locationCode").
+		Equal(expression.Value(req.LocationCode)).
+		And(expression.Key("polledEpochMs").Between(
+			expression.Value(start), expression.Value(req.To.UnixMilli()),
+		))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyExpr).Build()
+	if err != nil {
+		return Page{}, fmt.Errorf("failed to build ddb expression %w", err)
+	}
+
+	s := newSampler(req.From, req.Interval, req.Sample, req.Limit)
+	paginator := dynamodb.NewQueryPaginator(r.client, &dynamodb.QueryInput{
+		TableName:                 r.tableName,
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	for paginator.HasMorePages() && !s.full() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return Page{}, apperror.Store("failed to query history", err)
+		}
+		var snapshots []Snapshot
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &snapshots); err != nil {
+			return Page{}, fmt.Errorf("failed to decode snapshots: %w", err)
+		}
+		for _, snapshot := range snapshots {
+			if s.add(snapshot) {
+				break
+			}
+		}
+	}
+
+	result := Page{Snapshots: s.finish()}
+	if next, ok := s.resumeAt(); ok {
+		result.NextCursor = cursor{
+			From:   req.From.UnixMilli(),
+			To:     req.To.UnixMilli(),
+			Resume: next,
+		}.encode()
+	}
+	r.log.WithContext(ctx).WithFields(logrus.Fields{
+		"location_code": req.LocationCode,
+		"result_len":    len(result.Snapshots),
+	}).Info("history snapshots found.")
+	return result, nil
+}
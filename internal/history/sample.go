@@ -0,0 +1,69 @@
+package history
+
+import "time"
+
+// sampler downsamples snapshots arriving in polling order, keeping one per
+// interval long bucket counted from from. Buckets stay aligned to from
+// across pages so resuming from a cursor samples the same snapshots.
+type sampler struct {
+	from     int64
+	interval int64
+	last     bool
+	limit    int
+
+	out     []Snapshot
+	current *Snapshot
+	bucket  int64
+}
+
+func newSampler(
+	from time.Time, interval time.Duration, sample string, limit int,
+) *sampler {
+	// Without an interval every snapshot is its own bucket.
+	intervalMs := max(interval.Milliseconds(), 1)
+	return &sampler{
+		from:     from.UnixMilli(),
+		interval: intervalMs,
+		last:     sample == SampleLast,
+		limit:    limit,
+	}
+}
+
+// add reports whether the limit has been reached. A bucket's snapshot is
+// only kept once a snapshot from a later bucket arrives.
+func (s *sampler) add(snapshot Snapshot) bool {
+	bucket := (snapshot.PolledEpochMs - s.from) / s.interval
+	if s.current != nil && bucket == s.bucket {
+		if s.last {
+			s.current = &snapshot
+		}
+		return false
+	}
+	if s.current != nil {
+		s.out = append(s.out, *s.current)
+	}
+	s.current, s.bucket = &snapshot, bucket
+	return s.full()
+}
+
+func (s *sampler) full() bool {
+	return len(s.out) >= s.limit
+}
+
+// finish keeps the last bucket's snapshot when there is room for it.
+func (s *sampler) finish() []Snapshot {
+	if s.current != nil && !s.full() {
+		s.out = append(s.out, *s.current)
+		s.current = nil
+	}
+	return s.out
+}
+
+// resumeAt is where the next page starts, the start of the bucket that did
+// not fit. Only valid after finish.
+func (s *sampler) resumeAt() (int64, bool) {
+	if s.current == nil {
+		return 0, false
+	}
+	return s.from + s.bucket*s.interval, true
+}
@@ -0,0 +1,106 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func polledAt(ms ...int64) []Snapshot {
+	snapshots := make([]Snapshot, len(ms))
+	for i, m := range ms {
+		snapshots[i] = Snapshot{LocationCode: "K08", PolledEpochMs: m}
+	}
+	return snapshots
+}
+
+func sampled(s *sampler, snapshots []Snapshot) []int64 {
+	for _, snapshot := range snapshots {
+		if s.add(snapshot) {
+			break
+		}
+	}
+	var got []int64
+	for _, snapshot := range s.finish() {
+		got = append(got, snapshot.PolledEpochMs)
+	}
+	return got
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSamplerKeepsOneSnapshotPerInterval(t *testing.T) {
+	snapshots := polledAt(0, 20_000, 40_000, 60_000, 80_000, 130_000)
+	from := time.UnixMilli(0)
+
+	cases := []struct {
+		sample string
+		want   []int64
+	}{
+		{SampleFirst, []int64{0, 60_000, 130_000}},
+		{SampleLast, []int64{40_000, 80_000, 130_000}},
+	}
+	for _, tc := range cases {
+		s := newSampler(from, time.Minute, tc.sample, 10)
+		if got := sampled(s, snapshots); !equal(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.sample, tc.want, got)
+		}
+		if _, ok := s.resumeAt(); ok {
+			t.Errorf("%s: expected no next page", tc.sample)
+		}
+	}
+}
+
+func TestSamplerWithoutIntervalKeepsEverySnapshot(t *testing.T) {
+	s := newSampler(time.UnixMilli(0), 0, SampleFirst, 10)
+	want := []int64{0, 20_000, 40_000}
+	if got := sampled(s, polledAt(want...)); !equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSamplerResumesAtBucketThatDidNotFit(t *testing.T) {
+	snapshots := polledAt(0, 20_000, 70_000, 90_000, 130_000)
+	s := newSampler(time.UnixMilli(0), time.Minute, SampleLast, 1)
+
+	if got := sampled(s, snapshots); !equal(got, []int64{20_000}) {
+		t.Errorf("expected the first bucket, got %v", got)
+	}
+	resume, ok := s.resumeAt()
+	if !ok || resume != 60_000 {
+		t.Fatalf("expected to resume at 60000, got %d %v", resume, ok)
+	}
+
+	// The next page starts at the bucket boundary and samples the same way.
+	next := newSampler(time.UnixMilli(0), time.Minute, SampleLast, 1)
+	if got := sampled(next, snapshots[2:]); !equal(got, []int64{90_000}) {
+		t.Errorf("expected the second bucket, got %v", got)
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	c := cursor{From: 1_000, To: 5_000, Resume: 3_000}
+	got, err := decodeCursor(c.encode())
+	if err != nil || got != c {
+		t.Errorf("expected %+v, got %+v %v", c, got, err)
+	}
+
+	for _, raw := range []string{
+		"not base64!",
+		cursor{From: 1_000, To: 5_000, Resume: 6_000}.encode(),
+		cursor{From: 1_000, To: 5_000, Resume: 500}.encode(),
+	} {
+		if _, err := decodeCursor(raw); err != ErrInvalidCursor {
+			t.Errorf("%q: expected ErrInvalidCursor, got %v", raw, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAlreadyRunning = errors.New("job is already running")
+	ErrShuttingDown   = errors.New("job tracker is shutting down")
+)
+
+// Func is a unit of background work such as a train poll or station ingest.
+type Func func(ctx context.Context) error
+
+type Status struct {
+	Name           string    `json:"name"`
+	Running        bool      `json:"running"`
+	LastRun        time.Time `json:"last_run"`
+	LastDurationMs int64     `json:"last_duration_ms"`
+	Successes      int64     `json:"successes"`
+	Failures       int64     `json:"failures"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// Tracker records the outcome of every run of a named job so operators can
+// see what the background workers have been doing. It also lets shutdown
+// wait for running jobs instead of killing them mid-write.
+type Tracker struct {
+	mu       sync.Mutex
+	jobs     map[string]*Status
+	running  sync.WaitGroup
+	stopping bool
+	// Cancelled once the shutdown deadline passes, aborting running jobs.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewTracker() *Tracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Tracker{
+		jobs:   make(map[string]*Status),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// status must be called with mu held.
+func (t *Tracker) status(name string) *Status {
+	s, ok := t.jobs[name]
+	if !ok {
+		s = &Status{Name: name}
+		t.jobs[name] = s
+	}
+	return s
+}
+
+func (t *Tracker) begin(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopping {
+		return ErrShuttingDown
+	}
+	s := t.status(name)
+	if s.Running {
+		return ErrAlreadyRunning
+	}
+	s.Running = true
+	s.LastRun = time.Now()
+	t.running.Add(1)
+	return nil
+}
+
+func (t *Tracker) finish(name string, err error) {
+	defer t.running.Done()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.status(name)
+	s.Running = false
+	s.LastDurationMs = time.Since(s.LastRun).Milliseconds()
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+		return
+	}
+	s.Successes++
+}
+
+// jobContext is cancelled when either ctx is or the tracker is forced to
+// stop.
+func (t *Tracker) jobContext(ctx context.Context) (
+	context.Context, context.CancelFunc,
+) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(t.ctx, cancel)
+	return jobCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Run executes fn synchronously and records the result. It returns
+// ErrAlreadyRunning without calling fn if the job is in progress, or
+// ErrShuttingDown once Shutdown has been called.
+func (t *Tracker) Run(ctx context.Context, name string, fn Func) error {
+	if err := t.begin(name); err != nil {
+		return err
+	}
+	jobCtx, cancel := t.jobContext(ctx)
+	defer cancel()
+	err := fn(jobCtx)
+	t.finish(name, err)
+	return err
+}
+
+// Start executes fn on a new goroutine. It returns the same errors as Run
+// without calling fn.
+func (t *Tracker) Start(ctx context.Context, name string, fn Func) error {
+	if err := t.begin(name); err != nil {
+		return err
+	}
+	jobCtx, cancel := t.jobContext(ctx)
+	go func() {
+		defer cancel()
+		t.finish(name, fn(jobCtx))
+	}()
+	return nil
+}
+
+// Shutdown stops new jobs from starting and waits for running ones. If ctx
+// is done first the running jobs are cancelled and ctx's error returned.
+func (t *Tracker) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	t.stopping = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		t.cancel()
+		return ctx.Err()
+	}
+}
+
+// Statuses returns a copy of every known job status ordered by name.
+func (t *Tracker) Statuses() []Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]Status, 0, len(t.jobs))
+	for _, s := range t.jobs {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,83 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTrackerRecordsResults(t *testing.T) {
+	tracker := NewTracker()
+
+	_ = tracker.Run(context.Background(), "poll", func(context.Context) error {
+		return nil
+	})
+	_ = tracker.Run(context.Background(), "poll", func(context.Context) error {
+		return errors.New("boom")
+	})
+
+	statuses := tracker.Statuses()
+	if len(statuses) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(statuses))
+	}
+	s := statuses[0]
+	if s.Successes != 1 || s.Failures != 1 || s.LastError != "boom" {
+		t.Fatalf("unexpected status: %+v", s)
+	}
+	if s.Running {
+		t.Fatal("job should not be running")
+	}
+}
+
+func TestTrackerRejectsConcurrentRun(t *testing.T) {
+	tracker := NewTracker()
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	err := tracker.Start(context.Background(), "ingest", func(context.Context) error {
+		<-release
+		close(done)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected job to start, got %v", err)
+	}
+
+	err = tracker.Run(context.Background(), "ingest", func(context.Context) error {
+		return nil
+	})
+	if !errors.Is(err, ErrAlreadyRunning) {
+		t.Fatalf("expected ErrAlreadyRunning, got %v", err)
+	}
+	close(release)
+	<-done
+}
+
+func TestTrackerShutdownCancelsAfterDeadline(t *testing.T) {
+	tracker := NewTracker()
+	cancelled := make(chan struct{})
+
+	err := tracker.Start(context.Background(), "ingest", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("expected job to start, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tracker.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	<-cancelled
+
+	err = tracker.Run(context.Background(), "poll", func(context.Context) error {
+		return nil
+	})
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("expected ErrShuttingDown, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "linetracker"
+
+// Metrics holds every collector exposed on /metrics. All methods are safe to
+// call on a nil *Metrics so components can be built without metrics in tests.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	wmataRequests *prometheus.CounterVec
+	wmataDuration *prometheus.HistogramVec
+
+	pollDuration    prometheus.Histogram
+	polls           *prometheus.CounterVec
+	pollPredictions prometheus.Gauge
+	predictions     prometheus.Counter
+
+	ddbDuration *prometheus.HistogramVec
+	ddbErrors   *prometheus.CounterVec
+
+	// Unix ms of the last snapshot written to DDB, 0 until the first.
+	latestSnapshotMs atomic.Int64
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled by route and status.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		wmataRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "wmata_requests_total",
+			Help:      "WMATA API calls by endpoint and status.",
+		}, []string{"endpoint", "status"}),
+		wmataDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "wmata_request_duration_seconds",
+			Help:      "WMATA API call latency by endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		pollDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "poll_duration_seconds",
+			Help:      "Duration of a train poll cycle.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		polls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "polls_total",
+			Help:      "Train poll cycles by result.",
+		}, []string{"result"}),
+		pollPredictions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "poll_predictions",
+			Help:      "Predictions returned by the last successful poll.",
+		}),
+		predictions: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "predictions_total",
+			Help:      "Predictions returned by all polls.",
+		}),
+		ddbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "ddb_operation_duration_seconds",
+			Help:      "DynamoDB operation latency by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		ddbErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ddb_operation_errors_total",
+			Help:      "Failed DynamoDB operations by operation.",
+		}, []string{"operation"}),
+	}
+
+	latestSnapshotAge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "latest_snapshot_age_seconds",
+		Help: "Seconds since the latest prediction snapshot was stored, " +
+			"NaN until the first is stored.",
+	}, func() float64 {
+		age, ok := m.LatestSnapshotAge()
+		if !ok {
+			return math.NaN()
+		}
+		return age.Seconds()
+	})
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.wmataRequests,
+		m.wmataDuration,
+		m.pollDuration,
+		m.polls,
+		m.pollPredictions,
+		m.predictions,
+		m.ddbDuration,
+		m.ddbErrors,
+		latestSnapshotAge,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) ObserveHTTPRequest(
+	method string, route string, status int, duration time.Duration,
+) {
+	if m == nil {
+		return
+	}
+	m.httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// ObserveWMATARequest records a WMATA call, status is the HTTP status code or
+// "error" when no response was received.
+func (m *Metrics) ObserveWMATARequest(
+	endpoint string, status string, duration time.Duration,
+) {
+	if m == nil {
+		return
+	}
+	m.wmataRequests.WithLabelValues(endpoint, status).Inc()
+	m.wmataDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObservePoll(
+	duration time.Duration, predictions int, err error,
+) {
+	if m == nil {
+		return
+	}
+	m.pollDuration.Observe(duration.Seconds())
+	if err != nil {
+		m.polls.WithLabelValues("failure").Inc()
+		return
+	}
+	m.polls.WithLabelValues("success").Inc()
+	m.pollPredictions.Set(float64(predictions))
+	m.predictions.Add(float64(predictions))
+}
+
+func (m *Metrics) ObserveDDBOperation(
+	operation string, duration time.Duration, err error,
+) {
+	if m == nil {
+		return
+	}
+	m.ddbDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err != nil {
+		m.ddbErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// SnapshotStored records when the latest prediction snapshot was written.
+func (m *Metrics) SnapshotStored(timestamp time.Time) {
+	if m == nil {
+		return
+	}
+	m.latestSnapshotMs.Store(timestamp.UnixMilli())
+}
+
+// LatestSnapshotAge is how long ago the latest snapshot was stored, false
+// until one has been.
+func (m *Metrics) LatestSnapshotAge() (time.Duration, bool) {
+	if m == nil {
+		return 0, false
+	}
+	storedMs := m.latestSnapshotMs.Load()
+	if storedMs == 0 {
+		return 0, false
+	}
+	return time.Since(time.UnixMilli(storedMs)), true
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNilMetricsIsNoop(t *testing.T) {
+	var m *Metrics
+	m.ObserveHTTPRequest("GET", "/health", 200, time.Millisecond)
+	m.ObservePoll(time.Second, 3, nil)
+	m.SnapshotStored(time.Now())
+	if _, ok := m.LatestSnapshotAge(); ok {
+		t.Fatal("expected no snapshot age on nil metrics")
+	}
+}
+
+func TestHandlerExposesObservations(t *testing.T) {
+	m := New()
+	if _, ok := m.LatestSnapshotAge(); ok {
+		t.Fatal("expected no snapshot age before the first snapshot")
+	}
+
+	m.ObservePoll(time.Second, 42, nil)
+	m.ObservePoll(time.Second, 0, errors.New("boom"))
+	m.ObserveDDBOperation("Query", time.Millisecond, errors.New("boom"))
+	m.SnapshotStored(time.Now().Add(-time.Minute))
+
+	age, ok := m.LatestSnapshotAge()
+	if !ok || age < time.Minute {
+		t.Fatalf("expected snapshot age of at least a minute, got %v", age)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		`linetracker_polls_total{result="success"} 1`,
+		`linetracker_polls_total{result="failure"} 1`,
+		`linetracker_poll_predictions 42`,
+		`linetracker_ddb_operation_errors_total{operation="Query"} 1`,
+		`linetracker_latest_snapshot_age_seconds`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %q in metrics output", want)
+		}
+	}
+}
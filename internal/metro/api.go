@@ -1,37 +1,97 @@
 package metro
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
 
-	appConfig "github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	log    = appConfig.GetLogger()
-	config = appConfig.LoadConfig()
-)
+// Client calls the WMATA API with the configured API key.
+type Client struct {
+	apiKey  string
+	http    *http.Client
+	log     *logrus.Logger
+	metrics *metrics.Metrics
+	tracer  trace.Tracer
+	// Unix ms of the last call answered with 200, 0 until the first.
+	lastSuccessMs atomic.Int64
+}
+
+func NewClient(
+	c *config.Configuration,
+	log *logrus.Logger,
+	m *metrics.Metrics,
+	tp trace.TracerProvider,
+) *Client {
+	return &Client{
+		apiKey:  c.APIKey,
+		http:    c.Client,
+		log:     log,
+		metrics: m,
+		tracer:  tp.Tracer("github.com/reww406/linetracker/internal/metro"),
+	}
+}
 
-func GetRequest(url string, apiKey string) (*http.Request, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (c *Client) GetRequest(
+	ctx context.Context, url string,
+) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create get request: %w", err)
 	}
 
-	req.Header.Add("api_key", apiKey)
+	req.Header.Add("api_key", c.apiKey)
 	return req, nil
 }
 
-func ExecuteRequest(req *http.Request) ([]byte, error) {
-	client := config.Client
+func (c *Client) ExecuteRequest(req *http.Request) (body []byte, err error) {
+	ctx, span := c.tracer.Start(
+		req.Context(), "wmata "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.URLPath(req.URL.Path),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	req = req.WithContext(ctx)
 
-	log.WithField("http_req", req).Info("Executing request against metro API.")
+	log := c.log.WithContext(ctx)
+	log.WithField("url", req.URL.String()).Info(
+		"Executing request against metro API.",
+	)
 
-	resp, err := client.Do(req)
+	start := time.Now()
+	resp, err := c.http.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute get http request: %w", err)
+		c.metrics.ObserveWMATARequest(req.URL.Path, "error", time.Since(start))
+		return nil, apperror.Upstream("WMATA API is unavailable", fmt.Errorf(
+			"failed to execute get http request: %w", err,
+		))
 	}
+	c.metrics.ObserveWMATARequest(
+		req.URL.Path, strconv.Itoa(resp.StatusCode), time.Since(start),
+	)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
 
 	defer func() {
 		if cerr := resp.Body.Close(); cerr != nil {
@@ -40,10 +100,36 @@ func ExecuteRequest(req *http.Request) ([]byte, error) {
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf(
+		return nil, apperror.Upstream("WMATA API is unavailable", fmt.Errorf(
 			"failed GET request with status code: %d", resp.StatusCode,
-		)
+		))
 	}
 
-	return io.ReadAll(resp.Body)
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, apperror.Upstream("WMATA API is unavailable", fmt.Errorf(
+			"failed to read response body: %w", err,
+		))
+	}
+	c.lastSuccessMs.Store(time.Now().UnixMilli())
+	return body, nil
+}
+
+// LastSuccess is when the API last answered a request successfully, false
+// until it has.
+func (c *Client) LastSuccess() (time.Time, bool) {
+	successMs := c.lastSuccessMs.Load()
+	if successMs == 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(successMs), true
+}
+
+// Get builds and executes a GET request for url.
+func (c *Client) Get(ctx context.Context, url string) ([]byte, error) {
+	req, err := c.GetRequest(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExecuteRequest(req)
 }
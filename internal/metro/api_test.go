@@ -0,0 +1,56 @@
+package metro
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/reww406/linetracker/config"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestExecuteRequestRecordsSpan(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/fail" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		},
+	))
+	defer api.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	client := NewClient(
+		&config.Configuration{Client: api.Client()}, logrus.New(), nil, tp,
+	)
+
+	if _, err := client.Get(context.Background(), api.URL+"/ok"); err != nil {
+		t.Fatalf("expected request to succeed: %v", err)
+	}
+	if _, ok := client.LastSuccess(); !ok {
+		t.Error("expected last success to be recorded")
+	}
+	if _, err := client.Get(context.Background(), api.URL+"/fail"); err == nil {
+		t.Fatal("expected request to fail")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name() != "wmata /ok" || spans[0].Status().Code == codes.Error {
+		t.Errorf("unexpected span for successful call: %s %v",
+			spans[0].Name(), spans[0].Status())
+	}
+	if spans[1].Status().Code != codes.Error {
+		t.Errorf("expected failed call span to have error status, got %v",
+			spans[1].Status())
+	}
+}
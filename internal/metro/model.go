@@ -1,8 +1,5 @@
 package metro
 
-import "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-
-
 type LineCode string
 
 const (
@@ -11,15 +8,5 @@ const (
 	SilverLine LineCode = "SV"
 	BlueLine   LineCode = "BL"
 	GreenLine  LineCode = "GR"
+	YellowLine LineCode = "YL"
 )
-
-func ToLineCodes(codes []types.AttributeValue) []LineCode {
-	result := make([]LineCode, len(codes))
-	for i, code := range codes {
-		// TODO What the hell is happening here.
-		if sv, ok := code.(*types.AttributeValueMemberS); ok {
-			result[i] = LineCode(sv.Value)
-		}
-	}
-	return result
-}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// How often idle buckets are looked for and dropped.
+const sweepInterval = time.Minute
+
+// Result describes the caller's bucket after a request, it maps directly onto
+// the RateLimit-* response headers.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Until the bucket is full again.
+	Reset time.Duration
+	// Until the next request would be allowed, 0 when Allowed.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter keeps a token bucket per key such as a client IP or API key. A nil
+// *Limiter allows everything.
+type Limiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// New returns a limiter refilling perSecond tokens up to burst, or nil when
+// perSecond is 0 which disables limiting.
+func New(perSecond int, burst int) *Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &Limiter{
+		limit:     rate.Limit(perSecond),
+		burst:     burst,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *Limiter) Allow(key string) Result {
+	return l.allowAt(key, time.Now())
+}
+
+func (l *Limiter) allowAt(key string, now time.Time) Result {
+	if l == nil {
+		return Result{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	allowed := b.limiter.AllowN(now, 1)
+	tokens := b.limiter.TokensAt(now)
+	result := Result{
+		Allowed:   allowed,
+		Limit:     l.burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     l.refill(float64(l.burst) - tokens),
+	}
+	if !allowed {
+		result.RetryAfter = l.refill(1 - tokens)
+	}
+	return result
+}
+
+// refill is how long it takes to gain tokens.
+func (l *Limiter) refill(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / float64(l.limit) * float64(time.Second))
+}
+
+// sweep drops buckets that have been idle long enough to refill completely,
+// recreating them later is equivalent. Must be called with mu held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	idle := l.refill(float64(l.burst))
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > idle {
+			delete(l.buckets, key)
+		}
+	}
+}
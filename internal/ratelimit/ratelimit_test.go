@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllowsBurstThenRefills(t *testing.T) {
+	l := New(1, 2)
+	now := time.Now()
+
+	for i, wantRemaining := range []int{1, 0} {
+		result := l.allowAt("1.2.3.4", now)
+		if !result.Allowed || result.Remaining != wantRemaining {
+			t.Fatalf("request %d: expected allowed with %d remaining, got %+v",
+				i, wantRemaining, result)
+		}
+	}
+
+	result := l.allowAt("1.2.3.4", now)
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Fatalf("expected denial with 1s retry, got %+v", result)
+	}
+	if result.Limit != 2 || result.Reset != 2*time.Second {
+		t.Errorf("expected limit 2 and 2s reset, got %+v", result)
+	}
+
+	if other := l.allowAt("5.6.7.8", now); !other.Allowed {
+		t.Errorf("expected keys to have separate buckets, got %+v", other)
+	}
+	if later := l.allowAt("1.2.3.4", now.Add(time.Second)); !later.Allowed {
+		t.Errorf("expected a token after refilling, got %+v", later)
+	}
+}
+
+func TestLimiterDropsIdleBuckets(t *testing.T) {
+	l := New(1, 2)
+	now := time.Now()
+	l.allowAt("1.2.3.4", now)
+
+	l.allowAt("5.6.7.8", now.Add(sweepInterval))
+	if _, ok := l.buckets["1.2.3.4"]; ok {
+		t.Error("expected idle bucket to be dropped")
+	}
+}
+
+func TestNilLimiterAllowsEverything(t *testing.T) {
+	l := New(0, 10)
+	if result := l.Allow("1.2.3.4"); !result.Allowed {
+		t.Errorf("expected disabled limiter to allow, got %+v", result)
+	}
+}
@@ -0,0 +1,54 @@
+package station
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// stationCache holds the last full scan of the stations table. Station data
+// only changes on ingestion, which invalidates it, the TTL bounds how stale
+// other instances sharing the table can get.
+type stationCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	stations  []StationModel
+	fetchedAt time.Time
+}
+
+func newStationCache(ttl time.Duration) *stationCache {
+	return &stationCache{ttl: ttl}
+}
+
+// get returns the cached stations, calling load on a miss. Misses are
+// serialised so concurrent requests share a single scan. The returned slice
+// is shared and must not be modified.
+func (sc *stationCache) get(
+	ctx context.Context,
+	load func(ctx context.Context) ([]StationModel, error),
+) ([]StationModel, error) {
+	if sc.ttl <= 0 {
+		return load(ctx)
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.stations != nil && time.Since(sc.fetchedAt) < sc.ttl {
+		return sc.stations, nil
+	}
+
+	stations, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sc.stations = stations
+	sc.fetchedAt = time.Now()
+	return stations, nil
+}
+
+func (sc *stationCache) invalidate() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.stations = nil
+}
@@ -0,0 +1,53 @@
+package station
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStationCacheReusesScanUntilInvalidated(t *testing.T) {
+	cache := newStationCache(time.Hour)
+	scans := 0
+	load := func(ctx context.Context) ([]StationModel, error) {
+		scans++
+		return []StationModel{{Code: "A01"}}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.get(context.Background(), load); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if scans != 1 {
+		t.Errorf("expected 1 scan, got %d", scans)
+	}
+
+	cache.invalidate()
+	if _, err := cache.get(context.Background(), load); err != nil {
+		t.Fatal(err)
+	}
+	if scans != 2 {
+		t.Errorf("expected a rescan after invalidation, got %d scans", scans)
+	}
+}
+
+func TestStationCacheDoesNotKeepErrors(t *testing.T) {
+	cache := newStationCache(time.Hour)
+	failing := func(ctx context.Context) ([]StationModel, error) {
+		return nil, errors.New("scan failed")
+	}
+	if _, err := cache.get(context.Background(), failing); err == nil {
+		t.Fatal("expected scan error")
+	}
+
+	stations, err := cache.get(context.Background(),
+		func(ctx context.Context) ([]StationModel, error) {
+			return []StationModel{{Code: "A01"}}, nil
+		},
+	)
+	if err != nil || len(stations) != 1 {
+		t.Errorf("expected stations after a failed scan, got %v %v", stations, err)
+	}
+}
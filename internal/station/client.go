@@ -1,38 +1,40 @@
 package station
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
-	appConfig "github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/config"
 	"github.com/reww406/linetracker/internal/metro"
 	"github.com/sirupsen/logrus"
 )
 
-func requestStationTiming(stationCode string) ([]byte, error) {
-	config := appConfig.LoadConfig()
-	req, err := metro.GetRequest(
-		config.GetStationTimingAPI(stationCode), config.APIKey,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build request %w", err)
-	}
-	
-	return metro.ExecuteRequest(req)
+// Ingester loads stations and their schedules from the Metro API into the
+// station repository.
+type Ingester struct {
+	metro  *metro.Client
+	config *config.Configuration
+	repo   *Repository
+	log    *logrus.Logger
 }
 
-func requestStations() ([]byte, error) {
-	config := appConfig.LoadConfig()
-	req, err := metro.GetRequest(config.GetStationAPI(), config.APIKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build request %w", err)
+func NewIngester(
+	c *config.Configuration,
+	metroClient *metro.Client,
+	repo *Repository,
+	log *logrus.Logger,
+) *Ingester {
+	return &Ingester{
+		metro:  metroClient,
+		config: c,
+		repo:   repo,
+		log:    log,
 	}
-
-	return metro.ExecuteRequest(req)
 }
 
-func getStations() (*stationList, error) {
-	body, err := requestStations()
+func (in *Ingester) getStations(ctx context.Context) (*stationList, error) {
+	body, err := in.metro.Get(ctx, in.config.GetStationAPI())
 	if err != nil {
 		return nil, fmt.Errorf("requestStations failed with: %w", err)
 	}
@@ -42,26 +44,27 @@ func getStations() (*stationList, error) {
 		return nil, fmt.Errorf("failed to unmarshal stationList: %w", err)
 	}
 
-	log.WithFields(logrus.Fields{
+	in.log.WithContext(ctx).WithFields(logrus.Fields{
 		"stations_len": len(stations.Stations),
 	}).Info("got response from stations API.")
 
 	return &stations, nil
 }
 
-
-func getStationTimes(stationCode string) (*stationTimeList, error){
-	body, err := requestStationTiming(stationCode)
+func (in *Ingester) getStationTimes(
+	ctx context.Context, stationCode string,
+) (*stationTimeList, error) {
+	body, err := in.metro.Get(ctx, in.config.GetStationTimingAPI(stationCode))
 	if err != nil {
 		return nil, fmt.Errorf("requestStationTiming failed with %w", err)
 	}
 
-	var stationTimes stationTimeList 
+	var stationTimes stationTimeList
 	if err := json.Unmarshal(body, &stationTimes); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal stationList: %w", err)
 	}
 
-	log.Info("got stationTimes.")
+	in.log.WithContext(ctx).Info("got stationTimes.")
 
 	return &stationTimes, nil
 }
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/reww406/linetracker/internal/metro"
+	"github.com/sirupsen/logrus"
 )
 
 var days = []string{
@@ -71,18 +72,6 @@ type train struct {
 	DestinationStation string `json:"DestinationStation"`
 }
 
-type ListStationResp struct {
-	Stations []GetStationResp `json:"stations"`
-}
-
-type GetStationResp struct {
-	Address     address           `json:"address"`
-	LineCodes   []metro.LineCode  `json:"line_codes"`
-	StationCode string            `json:"station_code"`
-	Name        string            `json:"name"`
-	Schedule    []StationSchedule `json:"schedule"`
-}
-
 type StationModel struct {
 	Code            string            `dynamodbav:"code"`
 	City            string            `dynamodbav:"city"`
@@ -118,7 +107,9 @@ func (s *stationData) convertLineCodesToList() []metro.LineCode {
 	return result
 }
 
-func (st *stationTimeList) toStationSchedule() ([]StationSchedule, error) {
+func (st *stationTimeList) toStationSchedule(log logrus.FieldLogger) (
+	[]StationSchedule, error,
+) {
 	if len(st.StationTimes) != 1 {
 		return nil, fmt.Errorf(
 			"station times had more than one entry: %d",
@@ -177,8 +168,10 @@ func (st *stationTimeList) toDestinations() ([]string, error) {
 	return result, nil
 }
 
-func (s *stationData) toStationModel(stationTimes stationTimeList) StationModel {
-	daySchedules, err := stationTimes.toStationSchedule()
+func (s *stationData) toStationModel(
+	stationTimes stationTimeList, log logrus.FieldLogger,
+) StationModel {
+	daySchedules, err := stationTimes.toStationSchedule(log)
 	if err != nil {
 		log.WithError(err).Errorln(
 			"failed to covert stationTimes to DdbDaySchedule",
@@ -195,6 +188,7 @@ func (s *stationData) toStationModel(stationTimes stationTimeList) StationModel
 	return StationModel{
 		State:           s.Address.State,
 		City:            s.Address.City,
+		Street:          s.Address.Street,
 		Zip:             s.Address.Zip,
 		Code:            s.Code,
 		Latitude:        s.Latitude,
@@ -3,6 +3,8 @@ package station
 import (
 	"encoding/json"
 	"testing"
+
+	"github.com/sirupsen/logrus"
 )
 
 var stationTimes = stationTimeList{
@@ -100,7 +102,7 @@ func TestStationList(t *testing.T) {
 		},
 	}
 
-	stations.Stations[0].toStationModel(stationTimes)
+	stations.Stations[0].toStationModel(stationTimes, logrus.New())
 }
 
 func TestMarshallingToStationList(t *testing.T) {
@@ -126,6 +128,6 @@ func TestMarshallingToStationList(t *testing.T) {
 	}`
 	var stations stationList
 	if err := json.Unmarshal([]byte(input), &stations); err != nil {
-		log.Fatal(err.Error())	
+		t.Fatal(err.Error())
 	}
 }
@@ -0,0 +1,246 @@
+package station
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/metro"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+var (
+	ErrInvalidCursor = apperror.InvalidArgument("invalid cursor")
+	ErrInvalidSort   = apperror.InvalidArgument(
+		"sort must be code, name, -code or -name",
+	)
+)
+
+// ListStationsRequest selects one page of stations. Without Sort pages follow
+// the table's scan order, with it they are cut from the sorted station list.
+type ListStationsRequest struct {
+	// Optional, only stations on this line.
+	LineCode metro.LineCode
+	// code or name, prefixed with - for descending.
+	Sort string
+	// DefaultPageLimit when 0, at most MaxPageLimit.
+	Limit  int
+	Cursor string
+}
+
+type StationPage struct {
+	Stations []StationModel
+	// Empty on the last page.
+	NextCursor string
+}
+
+// cursor is the opaque position handed to clients. Scan pages only use Code,
+// the station's LastEvaluatedKey, sorted pages also record the sort and the
+// last station's sort value.
+type cursor struct {
+	Sort  string `json:"s,omitempty"`
+	After string `json:"a,omitempty"`
+	Code  string `json:"c"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string, sortBy string) (*cursor, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Code == "" {
+		return nil, ErrInvalidCursor
+	}
+	// A cursor only means something for the ordering it was issued for.
+	if c.Sort != sortBy {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// sortKey returns the value stations are ordered by, ties are broken by code.
+func sortKey(sortBy string) (func(StationModel) string, bool, error) {
+	descending := strings.HasPrefix(sortBy, "-")
+	switch strings.TrimPrefix(sortBy, "-") {
+	case "code":
+		return func(s StationModel) string { return s.Code }, descending, nil
+	case "name":
+		return func(s StationModel) string { return s.Name }, descending, nil
+	default:
+		return nil, false, ErrInvalidSort
+	}
+}
+
+func hasLine(station StationModel, lineCode metro.LineCode) bool {
+	for _, code := range station.LineCodes {
+		if code == lineCode {
+			return true
+		}
+	}
+	return false
+}
+
+// ListStationsPage returns one page of stations and the cursor for the next.
+func (r *Repository) ListStationsPage(
+	ctx context.Context, req ListStationsRequest,
+) (StationPage, error) {
+	if req.Limit <= 0 {
+		req.Limit = DefaultPageLimit
+	}
+	req.Limit = min(req.Limit, MaxPageLimit)
+
+	if req.Sort == "" {
+		return r.scanStationsPage(ctx, req)
+	}
+	return r.sortedStationsPage(ctx, req)
+}
+
+// sortedStationsPage pages through the cached station list, DDB cannot sort
+// a scan.
+func (r *Repository) sortedStationsPage(
+	ctx context.Context, req ListStationsRequest,
+) (StationPage, error) {
+	key, descending, err := sortKey(req.Sort)
+	if err != nil {
+		return StationPage{}, err
+	}
+	after, err := decodeCursor(req.Cursor, req.Sort)
+	if err != nil {
+		return StationPage{}, err
+	}
+
+	stations, err := r.ListStations(ctx)
+	if err != nil {
+		return StationPage{}, err
+	}
+
+	// Copy so the cached slice is never reordered.
+	matching := make([]StationModel, 0, len(stations))
+	for _, station := range stations {
+		if req.LineCode == "" || hasLine(station, req.LineCode) {
+			matching = append(matching, station)
+		}
+	}
+	less := func(a, b StationModel) bool {
+		ka, kb := key(a), key(b)
+		if ka != kb {
+			return (ka < kb) != descending
+		}
+		return (a.Code < b.Code) != descending
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return less(matching[i], matching[j])
+	})
+
+	start := 0
+	if after != nil {
+		last := StationModel{Code: after.Code, Name: after.After}
+		start = sort.Search(len(matching), func(i int) bool {
+			return less(last, matching[i])
+		})
+	}
+
+	end := min(start+req.Limit, len(matching))
+	page := StationPage{Stations: matching[start:end]}
+	if end < len(matching) {
+		lastStation := matching[end-1]
+		page.NextCursor = cursor{
+			Sort:  req.Sort,
+			After: key(lastStation),
+			Code:  lastStation.Code,
+		}.encode()
+	}
+	return page, nil
+}
+
+// scanStationsPage reads a page straight from DDB, continuing from the
+// cursor's LastEvaluatedKey. It keeps scanning until the page is full so the
+// line filter does not leave pages short.
+func (r *Repository) scanStationsPage(
+	ctx context.Context, req ListStationsRequest,
+) (StationPage, error) {
+	after, err := decodeCursor(req.Cursor, "")
+	if err != nil {
+		return StationPage{}, err
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName: r.tableName,
+	}
+	if after != nil {
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"code": &types.AttributeValueMemberS{Value: after.Code},
+		}
+	}
+	if req.LineCode != "" {
+		filter := expression.Contains(
+			expression.Name("lineCodes"), string(req.LineCode),
+		)
+		expr, err := expression.NewBuilder().WithFilter(filter).Build()
+		if err != nil {
+			return StationPage{}, fmt.Errorf(
+				"failed to build line filter: %w", err,
+			)
+		}
+		input.FilterExpression = expr.Filter()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+	}
+
+	var page StationPage
+	for {
+		// Never evaluate more items than still fit so LastEvaluatedKey is
+		// always the last station returned or skipped by the filter.
+		input.Limit = aws.Int32(int32(req.Limit - len(page.Stations)))
+		out, err := r.client.Scan(ctx, input)
+		if err != nil {
+			return StationPage{}, apperror.Store(
+				"failed to scan stations table", err,
+			)
+		}
+		for _, item := range out.Items {
+			station, err := itemToDdbStation(item)
+			if err != nil {
+				return StationPage{}, err
+			}
+			page.Stations = append(page.Stations, station)
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			return page, nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+		if len(page.Stations) >= req.Limit {
+			break
+		}
+	}
+
+	code, ok := input.ExclusiveStartKey["code"].(*types.AttributeValueMemberS)
+	if !ok {
+		return StationPage{}, errors.New("unexpected stations table key")
+	}
+	page.NextCursor = cursor{Code: code.Value}.encode()
+	return page, nil
+}
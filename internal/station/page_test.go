@@ -0,0 +1,81 @@
+package station
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/reww406/linetracker/internal/metro"
+)
+
+func newCachedRepository(stations []StationModel) *Repository {
+	cache := newStationCache(time.Hour)
+	cache.stations = stations
+	cache.fetchedAt = time.Now()
+	return &Repository{cache: cache}
+}
+
+func TestSortedStationsPageFollowsCursor(t *testing.T) {
+	repo := newCachedRepository([]StationModel{
+		{Code: "C01", Name: "Metro Center", LineCodes: []metro.LineCode{"RD", "BL"}},
+		{Code: "A01", Name: "Metro Center", LineCodes: []metro.LineCode{"RD"}},
+		{Code: "B02", Name: "Judiciary Square", LineCodes: []metro.LineCode{"RD"}},
+		{Code: "D01", Name: "Federal Triangle", LineCodes: []metro.LineCode{"BL"}},
+		{Code: "A02", Name: "Farragut North", LineCodes: []metro.LineCode{"RD"}},
+	})
+
+	var codes []string
+	req := ListStationsRequest{LineCode: "RD", Sort: "name", Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("cursor did not terminate")
+		}
+		page, err := repo.ListStationsPage(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, station := range page.Stations {
+			codes = append(codes, station.Code)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+
+	want := []string{"A02", "B02", "A01", "C01"}
+	if len(codes) != len(want) {
+		t.Fatalf("expected %v, got %v", want, codes)
+	}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, codes)
+		}
+	}
+}
+
+func TestStationsPageRejectsBadInput(t *testing.T) {
+	repo := newCachedRepository([]StationModel{{Code: "A01"}, {Code: "A02"}})
+
+	_, err := repo.ListStationsPage(context.Background(), ListStationsRequest{
+		Sort: "zip",
+	})
+	if !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("expected ErrInvalidSort, got %v", err)
+	}
+
+	page, err := repo.ListStationsPage(context.Background(), ListStationsRequest{
+		Sort: "-code", Limit: 1,
+	})
+	if err != nil || page.Stations[0].Code != "A02" {
+		t.Fatalf("expected A02 first in descending order, got %v %v", page, err)
+	}
+	// A cursor from one ordering cannot be used with another.
+	_, err = repo.ListStationsPage(context.Background(), ListStationsRequest{
+		Sort: "code", Cursor: page.NextCursor,
+	})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
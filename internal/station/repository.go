@@ -3,23 +3,44 @@ package station
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/reww406/linetracker/config"
-	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/apperror"
 	"github.com/sirupsen/logrus"
 )
 
-var log = config.GetLogger()
+const IngestJobName = "station_ingest"
 
-func getStationSchedules(stationList stationList) (
-	map[string]stationTimeList, error,
-) {
+// Repository reads and writes stations in DDB.
+type Repository struct {
+	client    *dynamodb.Client
+	tableName *string
+	log       *logrus.Logger
+	cache     *stationCache
+}
+
+func NewRepository(
+	client *dynamodb.Client, c *config.Configuration, log *logrus.Logger,
+) *Repository {
+	return &Repository{
+		client:    client,
+		tableName: c.StationTableName(),
+		log:       log,
+		cache:     newStationCache(c.StationCacheTTL),
+	}
+}
+
+func (in *Ingester) getStationSchedules(
+	ctx context.Context, stationList stationList,
+) (map[string]stationTimeList, error) {
 	// will tick 5 times a seconds.
 	limiter := time.NewTicker(200 * time.Millisecond)
 	defer limiter.Stop()
@@ -27,8 +48,12 @@ func getStationSchedules(stationList stationList) (
 	result := make(map[string]stationTimeList)
 	for _, station := range stationList.Stations {
 		// wait for limiter to deliever on a channel before running
-		<-limiter.C
-		stationTimes, err := getStationTimes(station.Code)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-limiter.C:
+		}
+		stationTimes, err := in.getStationTimes(ctx, station.Code)
 		if err != nil {
 			return nil, fmt.Errorf(
 				"failed to get station times for station: %s with error: %w",
@@ -41,34 +66,45 @@ func getStationSchedules(stationList stationList) (
 }
 
 func createStationModelWithSchedule(
-	stationList stationList, stationTimeLookup map[string]stationTimeList,
+	stationList stationList,
+	stationTimeLookup map[string]stationTimeList,
+	log logrus.FieldLogger,
 ) ([]StationModel, error) {
 	result := make([]StationModel, len(stationList.Stations))
 	for i, station := range stationList.Stations {
-		result[i] = station.toStationModel(stationTimeLookup[station.Code])
+		result[i] = station.toStationModel(stationTimeLookup[station.Code], log)
 	}
 	return result, nil
 }
 
-func InsertStations(ctx context.Context, client *dynamodb.Client) error {
-	stationList, err := getStations()
+func (in *Ingester) InsertStations(ctx context.Context) error {
+	stationList, err := in.getStations(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get stations: %w", err)
 	}
 
-	stationTimeLookup, err := getStationSchedules(*stationList)
+	stationTimeLookup, err := in.getStationSchedules(ctx, *stationList)
 	if err != nil {
 		return err
 	}
 
 	stationModel, err := createStationModelWithSchedule(*stationList,
-		stationTimeLookup,
+		stationTimeLookup, in.log.WithContext(ctx),
 	)
 	if err != nil {
 		return err
 	}
 
-	log.WithFields(logrus.Fields{
+	return in.repo.PutStations(ctx, stationModel)
+}
+
+func (r *Repository) PutStations(
+	ctx context.Context, stationModel []StationModel,
+) error {
+	// Even a partial write changes the table.
+	defer r.cache.invalidate()
+
+	r.log.WithContext(ctx).WithFields(logrus.Fields{
 		"stations_len": len(stationModel),
 	}).Info("inserting stations into DDB")
 
@@ -78,52 +114,29 @@ func InsertStations(ctx context.Context, client *dynamodb.Client) error {
 			return fmt.Errorf("failed to marshal station: %w", err)
 		}
 
-		_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
-			TableName: config.StationTableName,
+		_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: r.tableName,
 			Item:      item,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to insert station %s: %w", station.Code, err)
+			return apperror.Store(
+				fmt.Sprintf("failed to insert station %s", station.Code), err,
+			)
 		}
 	}
 	return nil
 }
 
-func ddbListToStringList(values []types.AttributeValue) []string {
-	result := make([]string, len(values))
-	for i, val := range values {
-		// TODO What the hell is happening here.
-		if sv, ok := val.(*types.AttributeValueMemberS); ok {
-			result[i] = sv.Value
-		}
-	}
-	return result
-}
-
-func itemToDdbStation(item map[string]types.AttributeValue) StationModel {
-	longitudeStr := item["longitude"].(*types.AttributeValueMemberN).Value
-	longitude, _ := strconv.ParseFloat(longitudeStr, 32)
-
-	latitudeStr := item["latitude"].(*types.AttributeValueMemberN).Value
-	latitude, _ := strconv.ParseFloat(latitudeStr, 32)
-
-	lineCodesStr := item["lineCodes"].(*types.AttributeValueMemberL).Value
-	lineCodes := metro.ToLineCodes(lineCodesStr)
-
-	return StationModel{
-		Code:         item["code"].(*types.AttributeValueMemberS).Value,
-		Name:         item["name"].(*types.AttributeValueMemberS).Value,
-		City:         item["city"].(*types.AttributeValueMemberS).Value,
-		Zip:          item["zip"].(*types.AttributeValueMemberS).Value,
-		Longitude:    float32(longitude),
-		Latitude:     float32(latitude),
-		Street:       item["street"].(*types.AttributeValueMemberS).Value,
-		State:        item["state"].(*types.AttributeValueMemberS).Value,
-		LineCodes:    lineCodes,
-		Destinations: ddbListToStringList(item["destinations"].(
-			*types.AttributeValueMemberL).Value,
-		),
+// itemToDdbStation decodes a stations table item, attributes missing from
+// older items are left empty.
+func itemToDdbStation(item map[string]types.AttributeValue) (
+	StationModel, error,
+) {
+	var station StationModel
+	if err := attributevalue.UnmarshalMap(item, &station); err != nil {
+		return StationModel{}, fmt.Errorf("failed to decode station: %w", err)
 	}
+	return station, nil
 }
 
 func createStationCodeLookup(stations []StationModel) map[string]StationModel {
@@ -134,11 +147,11 @@ func createStationCodeLookup(stations []StationModel) map[string]StationModel {
 	return result
 }
 
-func scanStations(ctx context.Context, client *dynamodb.Client) (
+func (r *Repository) scanStations(ctx context.Context) (
 	[]StationModel, error,
 ) {
-	paginator := dynamodb.NewScanPaginator(client, &dynamodb.ScanInput{
-		TableName: config.StationTableName,
+	paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+		TableName: r.tableName,
 	})
 
 	var result []StationModel
@@ -146,21 +159,41 @@ func scanStations(ctx context.Context, client *dynamodb.Client) (
 	for paginator.HasMorePages() {
 		page, err := paginator.NextPage(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failled to scan stations table: %w", err)
+			return nil, apperror.Store("failed to scan stations table", err)
 		}
 		for _, item := range page.Items {
-			result = append(result, itemToDdbStation(item))
+			station, err := itemToDdbStation(item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, station)
 		}
 	}
-	log.WithField("stationsFound", len(result)).Info("stations found from DDB.")
+	r.log.WithContext(ctx).WithField("stationsFound", len(result)).Info(
+		"stations found from DDB.",
+	)
 
 	return result, nil
 }
 
-func ListStations(ctx context.Context, client *dynamodb.Client) (
+// HasStations reports whether the stations table holds at least one station.
+func (r *Repository) HasStations(ctx context.Context) (bool, error) {
+	out, err := r.client.Scan(ctx, &dynamodb.ScanInput{
+		TableName: r.tableName,
+		Limit:     aws.Int32(1),
+	})
+	if err != nil {
+		return false, apperror.Store("failed to scan stations table", err)
+	}
+	return len(out.Items) > 0, nil
+}
+
+// ListStations returns every station, served from the cache when it is
+// fresh. The returned slice must not be modified.
+func (r *Repository) ListStations(ctx context.Context) (
 	[]StationModel, error,
 ) {
-	stations, err := scanStations(ctx, client)
+	stations, err := r.cache.get(ctx, r.scanStations)
 	if err != nil {
 		return nil, err
 	}
@@ -198,10 +231,10 @@ func findLastOpenClose(daySchedule []StationSchedule) [2]time.Time {
 }
 
 // TODO Test, also how range should be based on time.
-func GetPollerRange(ctx context.Context, client *dynamodb.Client) (
+func (r *Repository) GetPollerRange(ctx context.Context) (
 	*[2]time.Time, error,
 ) {
-	stations, err := scanStations(ctx, client)
+	stations, err := r.scanStations(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -220,14 +253,14 @@ func GetPollerRange(ctx context.Context, client *dynamodb.Client) (
 	return &result, nil
 }
 
-func GetDestinationStations(ctx context.Context, client *dynamodb.Client) (
+func (r *Repository) GetDestinationStations(ctx context.Context) (
 	[]StationModel, error,
 ) {
-	stations, err := scanStations(ctx, client)
-	stationCodeLookup := createStationCodeLookup(stations)
+	stations, err := r.cache.get(ctx, r.scanStations)
 	if err != nil {
 		return nil, err
 	}
+	stationCodeLookup := createStationCodeLookup(stations)
 	set := make(map[string]StationModel)
 	for _, station := range stations {
 		for _, destination := range station.Destinations {
@@ -239,6 +272,10 @@ func GetDestinationStations(ctx context.Context, client *dynamodb.Client) (
 	for _, v := range set {
 		result = append(result, v)
 	}
+	// Map order is random, keep responses stable so their ETag is too.
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Code < result[j].Code
+	})
 
 	return result, nil
 }
@@ -0,0 +1,58 @@
+package station
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/reww406/linetracker/internal/metro"
+)
+
+func TestStationItemRoundTrip(t *testing.T) {
+	want := StationModel{
+		Code:      "E10",
+		City:      "Greenbelt",
+		State:     "MD",
+		Street:    "5717 Greenbelt Metro Drive",
+		Zip:       "20740",
+		Latitude:  39.011,
+		Longitude: -76.911,
+		Name:      "Greenbelt",
+		LineCodes: []metro.LineCode{metro.GreenLine, metro.YellowLine},
+		StationSchedule: []StationSchedule{
+			{Day: "Monday", OpeningTime: "04:50", LastTrain: "23:26"},
+			{Day: "Sunday", OpeningTime: "06:50", LastTrain: ""},
+		},
+		Destinations: []string{"F11"},
+	}
+	item, err := attributevalue.MarshalMap(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := itemToDdbStation(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip changed the station:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestStationItemDecodingDoesNotPanic(t *testing.T) {
+	// Written before street and schedules were stored.
+	got, err := itemToDdbStation(map[string]types.AttributeValue{
+		"code": &types.AttributeValueMemberS{Value: "A01"},
+	})
+	if err != nil || got.Code != "A01" || got.Street != "" {
+		t.Errorf("expected a partial station, got %+v %v", got, err)
+	}
+
+	_, err = itemToDdbStation(map[string]types.AttributeValue{
+		"latitude": &types.AttributeValueMemberS{Value: "north"},
+	})
+	if err == nil {
+		t.Error("expected an error for a mistyped attribute")
+	}
+}
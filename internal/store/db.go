@@ -3,19 +3,24 @@ package store
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
 	appConfig "github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/metrics"
 	"github.com/reww406/linetracker/internal/station"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var log = appConfig.GetLogger()
-
 func tableExists(
 	ctx context.Context, client *dynamodb.Client, tableName *string,
 ) bool {
@@ -40,133 +45,215 @@ func tableItemCount(
 	return int(*result.Table.ItemCount), nil
 }
 
-func createStationsTable(client *dynamodb.Client) error {
-	log.WithFields(logrus.Fields{
-		"TableName": appConfig.StationTableName,
-	}).Info("Creating DDB Table")
-	_, err := client.CreateTable(context.Background(), &dynamodb.CreateTableInput{
-		TableName: appConfig.StationTableName,
-		AttributeDefinitions: []types.AttributeDefinition{
-			{
-				AttributeName: aws.String("code"),
-				AttributeType: types.ScalarAttributeTypeS,
-			},
-		},
-		KeySchema: []types.KeySchemaElement{
-			{
-				AttributeName: aws.String("code"),
-				KeyType:       types.KeyTypeHash,
-			},
-		},
-		ProvisionedThroughput: &types.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(5),
-			WriteCapacityUnits: aws.Int64(5),
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("error creating stations table: %w", err)
-	}
-	return nil
-}
-
-func createTrainTable(client *dynamodb.Client) error {
-	log.WithFields(logrus.Fields{
-		"TableName": appConfig.TrainTableName,
-	}).Info("Creating DDB table")
-	_, err := client.CreateTable(context.Background(), &dynamodb.CreateTableInput{
-		TableName: appConfig.TrainTableName,
-		AttributeDefinitions: []types.AttributeDefinition{
-			{
-				AttributeName: aws.String("locationCode"),
-				AttributeType: types.ScalarAttributeTypeS,
-			},
-			{
-				AttributeName: aws.String("createdEpochMs"),
-				AttributeType: types.ScalarAttributeTypeN,
-			},
-		},
-		KeySchema: []types.KeySchemaElement{
-			{
-				AttributeName: aws.String("locationCode"),
-				KeyType:       types.KeyTypeHash,
-			},
-			{
-				AttributeName: aws.String("createdEpochMs"),
-				KeyType:       types.KeyTypeRange,
-			},
-		},
-		ProvisionedThroughput: &types.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(5),
-			WriteCapacityUnits: aws.Int64(5),
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("error creating stations table: %w", err)
-	}
-	return nil
-}
-
-func initStationsTable(client *dynamodb.Client) error {
+func initStationsTable(
+	ctx context.Context,
+	client *dynamodb.Client,
+	tableName *string,
+	ingester *station.Ingester,
+	log *logrus.Logger,
+) error {
 	// Insert stations if they don't already exist
-	count, err := tableItemCount(
-		context.Background(), client, appConfig.StationTableName,
-	)
+	count, err := tableItemCount(ctx, client, tableName)
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"TableName": appConfig.StationTableName,
+			"TableName": *tableName,
 		}).Warn("failed to get item count from table.")
 	}
 	if count <= 0 {
 		log.WithFields(logrus.Fields{
-			"TableName": appConfig.StationTableName,
+			"TableName": *tableName,
 		}).Info("inserting stations into DDB.")
 
-		if err := station.InsertStations(context.Background(), client); err != nil {
-			return fmt.Errorf("failed to insert stations table: %w", err) 
+		if err := ingester.InsertStations(ctx); err != nil {
+			return fmt.Errorf("failed to insert stations table: %w", err)
 		}
 	}
 	return nil
 }
 
-func InitDB() (*dynamodb.Client, error) {
+// Ping checks that DDB is reachable and both tables exist.
+func Ping(
+	ctx context.Context, client *dynamodb.Client, c *appConfig.Configuration,
+) error {
+	for _, tableName := range []*string{
+		c.StationTableName(), c.PredictionTableName(),
+	} {
+		_, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+			TableName: tableName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe table %s: %w", *tableName, err)
+		}
+	}
+	return nil
+}
+
+// loadAWSConfig uses static credentials when an access key is configured and
+// the default AWS credential chain otherwise.
+func loadAWSConfig(
+	ctx context.Context, c *appConfig.Configuration,
+) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(c.DDBRegion),
+	}
+	if c.DDBAccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(
+				c.DDBAccessKeyID,
+				c.DDBSecretAccessKey,
+				c.DDBSessionToken,
+			),
+		))
+	}
+	return config.LoadDefaultConfig(ctx, opts...)
+}
+
+// observeOperations records the latency and outcome of every DDB operation,
+// including retries, in m.
+func observeOperations(m *metrics.Metrics) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+			"LinetrackerMetrics",
+			func(
+				ctx context.Context,
+				in middleware.InitializeInput,
+				next middleware.InitializeHandler,
+			) (middleware.InitializeOutput, middleware.Metadata, error) {
+				start := time.Now()
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				m.ObserveDDBOperation(
+					awsmiddleware.GetOperationName(ctx), time.Since(start), err,
+				)
+				return out, metadata, err
+			},
+		), middleware.After)
+	}
+}
+
+// tableName returns the table an operation's input targets, empty for
+// operations the repositories do not use.
+func tableName(input interface{}) string {
+	var name *string
+	switch in := input.(type) {
+	case *dynamodb.QueryInput:
+		name = in.TableName
+	case *dynamodb.ScanInput:
+		name = in.TableName
+	case *dynamodb.PutItemInput:
+		name = in.TableName
+	case *dynamodb.DescribeTableInput:
+		name = in.TableName
+	case *dynamodb.CreateTableInput:
+		name = in.TableName
+	case *dynamodb.UpdateTableInput:
+		name = in.TableName
+	case *dynamodb.UpdateItemInput:
+		name = in.TableName
+	}
+	return aws.ToString(name)
+}
+
+// traceOperations starts a client span around every DDB operation so the
+// time spent in DDB shows up under the request or poll that caused it.
+func traceOperations(tracer trace.Tracer) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc(
+			"LinetrackerTracing",
+			func(
+				ctx context.Context,
+				in middleware.InitializeInput,
+				next middleware.InitializeHandler,
+			) (middleware.InitializeOutput, middleware.Metadata, error) {
+				operation := awsmiddleware.GetOperationName(ctx)
+				attrs := []attribute.KeyValue{
+					semconv.DBSystemDynamoDB,
+					semconv.DBOperationName(operation),
+				}
+				if table := tableName(in.Parameters); table != "" {
+					attrs = append(attrs, semconv.AWSDynamoDBTableNames(table))
+				}
+
+				ctx, span := tracer.Start(
+					ctx, "DynamoDB."+operation,
+					trace.WithSpanKind(trace.SpanKindClient),
+					trace.WithAttributes(attrs...),
+				)
+				defer span.End()
+
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				if err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+				}
+				return out, metadata, err
+			},
+		), middleware.After)
+	}
+}
+
+// NewClient creates a DDB client for the configured endpoint and region.
+func NewClient(
+	ctx context.Context,
+	c *appConfig.Configuration,
+	m *metrics.Metrics,
+	tp trace.TracerProvider,
+) (*dynamodb.Client, error) {
 	// Configure AWS SDK
-	cfg, err := config.LoadDefaultConfig(context.Background(),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-			"local",
-			"local",
-			"local",
-		)),
-		config.WithRegion("us-east-1"),
-	)
+	cfg, err := loadAWSConfig(ctx, c)
 	if err != nil {
 		return nil, fmt.Errorf("unable to load SDK config: %w", err)
 	}
 
-	// Create DynamoDB client with local endpoint
-	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
-		o.BaseEndpoint = aws.String("http://localhost:8000/")
-	})
-
-	// Define table, you can have two primary keys (one for uniquness, one for sorting).
-	if !tableExists(context.Background(), client, appConfig.StationTableName) {
-		err = createStationsTable(client)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create station table: %w", err)
+	return dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if c.DDBEndpoint != "" {
+			o.BaseEndpoint = aws.String(c.DDBEndpoint)
 		}
-	}
+		o.APIOptions = append(
+			o.APIOptions,
+			traceOperations(
+				tp.Tracer("github.com/reww406/linetracker/internal/store"),
+			),
+			observeOperations(m),
+		)
+	}), nil
+}
 
-	if !tableExists(context.Background(), client, appConfig.TrainTableName) {
-		err = createTrainTable(client)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create train table: %w", err)
+// InitDB brings the tables up to date, applying pending migrations when
+// AutoMigrate is set and failing when it is not, then seeds the stations
+// table with ingester when it is empty.
+func InitDB(
+	ctx context.Context,
+	client *dynamodb.Client,
+	c *appConfig.Configuration,
+	ingester *station.Ingester,
+	log *logrus.Logger,
+) error {
+	log.WithFields(logrus.Fields{
+		"endpoint": c.DDBEndpoint,
+		"region":   c.DDBRegion,
+	}).Info("connecting to DDB.")
 
+	migrator := NewMigrator(client, c, log)
+	if c.AutoMigrate {
+		if _, err := migrator.Migrate(ctx); err != nil {
+			return fmt.Errorf("failed to migrate DDB: %w", err)
+		}
+	} else {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf(
+				"%d migrations are pending, run the migrate command", len(pending),
+			)
 		}
 	}
 
-	err = initStationsTable(client)
+	err := initStationsTable(ctx, client, c.StationTableName(), ingester, log)
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert stations: %w", err)
+		return fmt.Errorf("failed to insert stations: %w", err)
 	}
 
-	return client, nil
+	return nil
 }
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// DumpTable scans every item of tableName and passes it to fn decoded into
+// plain Go values, stopping at the first error fn returns.
+func DumpTable(
+	ctx context.Context,
+	client *dynamodb.Client,
+	tableName *string,
+	fn func(item map[string]any) error,
+) error {
+	paginator := dynamodb.NewScanPaginator(client, &dynamodb.ScanInput{
+		TableName: tableName,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to scan table %s: %w", *tableName, err)
+		}
+		for _, raw := range page.Items {
+			var item map[string]any
+			if err := attributevalue.UnmarshalMap(raw, &item); err != nil {
+				return fmt.Errorf("failed to decode item: %w", err)
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,564 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	appConfig "github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/train"
+	"github.com/sirupsen/logrus"
+)
+
+// How long to wait for a table or index to become active.
+const activeTimeout = 5 * time.Minute
+
+// Migration is one versioned change to the tables. Up must be safe to run
+// again since a migration that fails part way is retried from the start.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, m *Migrator) error
+}
+
+// AppliedMigration is the record kept in the migrations table.
+type AppliedMigration struct {
+	Version     int       `dynamodbav:"version"`
+	Description string    `dynamodbav:"description"`
+	AppliedAt   time.Time `dynamodbav:"appliedAt"`
+}
+
+// Migrations are applied in Version order, append new ones to the end and
+// never change one that has shipped.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create stations table",
+		Up: func(ctx context.Context, m *Migrator) error {
+			return m.CreateTable(ctx, &dynamodb.CreateTableInput{
+				TableName: m.config.StationTableName(),
+				AttributeDefinitions: []types.AttributeDefinition{
+					{
+						AttributeName: aws.String("code"),
+						AttributeType: types.ScalarAttributeTypeS,
+					},
+				},
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String("code"),
+						KeyType:       types.KeyTypeHash,
+					},
+				},
+				ProvisionedThroughput: &types.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(5),
+					WriteCapacityUnits: aws.Int64(5),
+				},
+			})
+		},
+	},
+	{
+		// Predictions from one poll share createdEpochMs so they are sorted
+		// by predictionKey.
+		Version:     2,
+		Description: "create train predictions table",
+		Up: func(ctx context.Context, m *Migrator) error {
+			return m.CreateTable(ctx, &dynamodb.CreateTableInput{
+				TableName: m.config.PredictionTableName(),
+				AttributeDefinitions: []types.AttributeDefinition{
+					{
+						AttributeName: aws.String("locationCode"),
+						AttributeType: types.ScalarAttributeTypeS,
+					},
+					{
+						AttributeName: aws.String("predictionKey"),
+						AttributeType: types.ScalarAttributeTypeS,
+					},
+				},
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String("locationCode"),
+						KeyType:       types.KeyTypeHash,
+					},
+					{
+						AttributeName: aws.String("predictionKey"),
+						KeyType:       types.KeyTypeRange,
+					},
+				},
+				ProvisionedThroughput: &types.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(5),
+					WriteCapacityUnits: aws.Int64(5),
+				},
+			})
+		},
+	},
+	{
+		Version:     3,
+		Description: "add train predictions line index",
+		Up: func(ctx context.Context, m *Migrator) error {
+			return m.AddIndex(ctx, m.config.PredictionTableName(), trainIndex(
+				train.LineIndex, "lineCode",
+			))
+		},
+	},
+	{
+		Version:     4,
+		Description: "add train predictions destination index",
+		Up: func(ctx context.Context, m *Migrator) error {
+			return m.AddIndex(ctx, m.config.PredictionTableName(), trainIndex(
+				train.DestinationIndex, "destinationCode",
+			))
+		},
+	},
+	{
+		Version:     5,
+		Description: "expire train predictions on expiresAt",
+		Up: func(ctx context.Context, m *Migrator) error {
+			return m.EnableTTL(ctx, m.config.PredictionTableName(), "expiresAt")
+		},
+	},
+	{
+		Version:     6,
+		Description: "backfill train predictions expiresAt",
+		Up: func(ctx context.Context, m *Migrator) error {
+			retention := m.config.TrainRetention
+			if retention <= 0 {
+				return nil
+			}
+			return m.Backfill(
+				ctx, m.config.PredictionTableName(), "expiresAt",
+				[]string{"locationCode", "predictionKey"},
+				func(item map[string]types.AttributeValue) (any, error) {
+					var key struct {
+						PredictionKey string `dynamodbav:"predictionKey"`
+					}
+					if err := attributevalue.UnmarshalMap(item, &key); err != nil {
+						return nil, err
+					}
+					polled, err := train.PollTime(key.PredictionKey)
+					if err != nil {
+						return nil, err
+					}
+					return polled.Add(retention).Unix(), nil
+				},
+			)
+		},
+	},
+	{
+		Version:     7,
+		Description: "create train history table",
+		Up: func(ctx context.Context, m *Migrator) error {
+			return m.CreateTable(ctx, &dynamodb.CreateTableInput{
+				TableName: m.config.HistoryTableName(),
+				AttributeDefinitions: []types.AttributeDefinition{
+					{
+						AttributeName: aws.String("locationCode"),
+						AttributeType: types.ScalarAttributeTypeS,
+					},
+					{
+						AttributeName: aws.String("polledEpochMs"),
+						AttributeType: types.ScalarAttributeTypeN,
+					},
+				},
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String("locationCode"),
+						KeyType:       types.KeyTypeHash,
+					},
+					{
+						AttributeName: aws.String("polledEpochMs"),
+						KeyType:       types.KeyTypeRange,
+					},
+				},
+				BillingMode: types.BillingModePayPerRequest,
+			})
+		},
+	},
+	{
+		Version:     8,
+		Description: "expire train history on expiresAt",
+		Up: func(ctx context.Context, m *Migrator) error {
+			return m.EnableTTL(ctx, m.config.HistoryTableName(), "expiresAt")
+		},
+	},
+}
+
+// trainIndex is a GSI on the trains table keyed by hashKey and sorted by
+// createdEpochMs, projecting every attribute.
+func trainIndex(name, hashKey string) types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName: aws.String(name),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String(hashKey),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("createdEpochMs"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		Projection: &types.Projection{
+			ProjectionType: types.ProjectionTypeAll,
+		},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		},
+	}
+}
+
+// Migrator applies Migrations and records each applied version in the
+// migrations table. It also gives migrations idempotent building blocks.
+type Migrator struct {
+	client     *dynamodb.Client
+	config     *appConfig.Configuration
+	log        *logrus.Logger
+	migrations []Migration
+}
+
+func NewMigrator(
+	client *dynamodb.Client, c *appConfig.Configuration, log *logrus.Logger,
+) *Migrator {
+	return &Migrator{
+		client:     client,
+		config:     c,
+		log:        log,
+		migrations: Migrations,
+	}
+}
+
+// Applied returns the recorded migrations ordered by version, creating the
+// migrations table if it does not exist yet.
+func (m *Migrator) Applied(ctx context.Context) ([]AppliedMigration, error) {
+	err := m.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: m.config.MigrationTableName(),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("version"),
+				AttributeType: types.ScalarAttributeTypeN,
+			},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("version"),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []AppliedMigration
+	paginator := dynamodb.NewScanPaginator(m.client, &dynamodb.ScanInput{
+		TableName: m.config.MigrationTableName(),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan migrations table: %w", err)
+		}
+		var records []AppliedMigration
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &records); err != nil {
+			return nil, fmt.Errorf("failed to decode migrations: %w", err)
+		}
+		applied = append(applied, records...)
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].Version < applied[j].Version
+	})
+	return applied, nil
+}
+
+// Pending returns the migrations that have not been applied, in order.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pending(m.migrations, applied), nil
+}
+
+func pending(migrations []Migration, applied []AppliedMigration) []Migration {
+	done := make(map[int]bool, len(applied))
+	for _, migration := range applied {
+		done[migration.Version] = true
+	}
+	var result []Migration
+	for _, migration := range migrations {
+		if !done[migration.Version] {
+			result = append(result, migration)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+// Migrate applies every pending migration in order, stopping at the first
+// that fails. It returns the migrations it applied.
+func (m *Migrator) Migrate(ctx context.Context) ([]Migration, error) {
+	todo, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range todo {
+		log := m.log.WithContext(ctx).WithFields(logrus.Fields{
+			"version":     migration.Version,
+			"description": migration.Description,
+		})
+		log.Info("applying migration.")
+		if err := migration.Up(ctx, m); err != nil {
+			return applied, fmt.Errorf(
+				"migration %d %q failed: %w",
+				migration.Version, migration.Description, err,
+			)
+		}
+
+		item, err := attributevalue.MarshalMap(AppliedMigration{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().UTC(),
+		})
+		if err != nil {
+			return applied, fmt.Errorf("failed to marshal migration: %w", err)
+		}
+		_, err = m.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: m.config.MigrationTableName(),
+			Item:      item,
+		})
+		if err != nil {
+			return applied, fmt.Errorf(
+				"failed to record migration %d: %w", migration.Version, err,
+			)
+		}
+		applied = append(applied, migration)
+		log.Info("migration applied.")
+	}
+	return applied, nil
+}
+
+// CreateTable creates the table unless it exists and waits until it is
+// active.
+func (m *Migrator) CreateTable(
+	ctx context.Context, input *dynamodb.CreateTableInput,
+) error {
+	if !tableExists(ctx, m.client, input.TableName) {
+		m.log.WithContext(ctx).WithFields(logrus.Fields{
+			"TableName": *input.TableName,
+		}).Info("Creating DDB table")
+		if _, err := m.client.CreateTable(ctx, input); err != nil {
+			return fmt.Errorf(
+				"error creating table %s: %w", *input.TableName, err,
+			)
+		}
+	}
+	err := dynamodb.NewTableExistsWaiter(m.client).Wait(
+		ctx,
+		&dynamodb.DescribeTableInput{TableName: input.TableName},
+		activeTimeout,
+	)
+	if err != nil {
+		return fmt.Errorf(
+			"table %s did not become active: %w", *input.TableName, err,
+		)
+	}
+	return nil
+}
+
+// AddIndex adds a GSI whose key attributes are strings and numbers unless
+// the table already has it, then waits until it is active. DDB builds one
+// index at a time so each needs its own migration.
+func (m *Migrator) AddIndex(
+	ctx context.Context, tableName *string, index types.GlobalSecondaryIndex,
+) error {
+	name := aws.ToString(index.IndexName)
+	status, err := m.indexStatus(ctx, tableName, name)
+	if err != nil {
+		return err
+	}
+	if status == "" {
+		m.log.WithContext(ctx).WithFields(logrus.Fields{
+			"TableName": *tableName,
+			"IndexName": name,
+		}).Info("Creating DDB index")
+		// Attribute types are declared alongside the index, the hash key is
+		// a string and the range key a number.
+		definitions := []types.AttributeDefinition{{
+			AttributeName: index.KeySchema[0].AttributeName,
+			AttributeType: types.ScalarAttributeTypeS,
+		}}
+		if len(index.KeySchema) > 1 {
+			definitions = append(definitions, types.AttributeDefinition{
+				AttributeName: index.KeySchema[1].AttributeName,
+				AttributeType: types.ScalarAttributeTypeN,
+			})
+		}
+		_, err := m.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName:            tableName,
+			AttributeDefinitions: definitions,
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+				{Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:             index.IndexName,
+					KeySchema:             index.KeySchema,
+					Projection:            index.Projection,
+					ProvisionedThroughput: index.ProvisionedThroughput,
+				}},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create index %s: %w", name, err)
+		}
+	}
+	return m.waitForIndex(ctx, tableName, name)
+}
+
+// indexStatus returns the GSI's status, empty when the table does not have
+// it.
+func (m *Migrator) indexStatus(
+	ctx context.Context, tableName *string, name string,
+) (types.IndexStatus, error) {
+	out, err := m.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: tableName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe table %s: %w", *tableName, err)
+	}
+	for _, index := range out.Table.GlobalSecondaryIndexes {
+		if aws.ToString(index.IndexName) == name {
+			return index.IndexStatus, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *Migrator) waitForIndex(
+	ctx context.Context, tableName *string, name string,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, activeTimeout)
+	defer cancel()
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		status, err := m.indexStatus(ctx, tableName, name)
+		if err != nil {
+			return err
+		}
+		if status == types.IndexStatusActive {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("index %s did not become active: %w", name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// EnableTTL has DDB delete items once the Unix seconds in attribute have
+// passed.
+func (m *Migrator) EnableTTL(
+	ctx context.Context, tableName *string, attribute string,
+) error {
+	out, err := m.client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{
+		TableName: tableName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe TTL of %s: %w", *tableName, err)
+	}
+	if ttl := out.TimeToLiveDescription; ttl != nil &&
+		aws.ToString(ttl.AttributeName) == attribute &&
+		(ttl.TimeToLiveStatus == types.TimeToLiveStatusEnabled ||
+			ttl.TimeToLiveStatus == types.TimeToLiveStatusEnabling) {
+		return nil
+	}
+
+	_, err = m.client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: tableName,
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(attribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable TTL on %s: %w", *tableName, err)
+	}
+	return nil
+}
+
+// Backfill sets attribute on every item that lacks it to the value returned
+// by valueFn, which is given the item's key attributes.
+func (m *Migrator) Backfill(
+	ctx context.Context,
+	tableName *string,
+	attribute string,
+	keys []string,
+	valueFn func(key map[string]types.AttributeValue) (any, error),
+) error {
+	projection := expression.NamesList(expression.Name(keys[0]))
+	for _, key := range keys[1:] {
+		projection = projection.AddNames(expression.Name(key))
+	}
+	expr, err := expression.NewBuilder().
+		WithFilter(expression.AttributeNotExists(expression.Name(attribute))).
+		WithProjection(projection).
+		Build()
+	if err != nil {
+		return fmt.Errorf("failed to build ddb expression %w", err)
+	}
+
+	updated := 0
+	paginator := dynamodb.NewScanPaginator(m.client, &dynamodb.ScanInput{
+		TableName:                 tableName,
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", *tableName, err)
+		}
+		for _, key := range page.Items {
+			value, err := valueFn(key)
+			if err != nil {
+				return fmt.Errorf("failed to compute %s: %w", attribute, err)
+			}
+			update, err := expression.NewBuilder().WithUpdate(
+				expression.Set(expression.Name(attribute), expression.Value(value)),
+			).Build()
+			if err != nil {
+				return fmt.Errorf("failed to build ddb expression %w", err)
+			}
+			_, err = m.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:                 tableName,
+				Key:                       key,
+				UpdateExpression:          update.Update(),
+				ExpressionAttributeNames:  update.Names(),
+				ExpressionAttributeValues: update.Values(),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update item in %s: %w", *tableName, err)
+			}
+			updated++
+		}
+	}
+	m.log.WithContext(ctx).WithFields(logrus.Fields{
+		"TableName": *tableName,
+		"attribute": attribute,
+		"updated":   updated,
+	}).Info("backfill finished.")
+	return nil
+}
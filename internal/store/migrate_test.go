@@ -0,0 +1,31 @@
+package store
+
+import "testing"
+
+func TestMigrationsAreOrderedAndUnique(t *testing.T) {
+	for i, migration := range Migrations {
+		if migration.Version != i+1 {
+			t.Errorf(
+				"expected migration %q to be version %d, got %d",
+				migration.Description, i+1, migration.Version,
+			)
+		}
+		if migration.Description == "" || migration.Up == nil {
+			t.Errorf("migration %d needs a description and Up", migration.Version)
+		}
+	}
+}
+
+func TestPendingSkipsApplied(t *testing.T) {
+	migrations := []Migration{{Version: 3}, {Version: 1}, {Version: 2}}
+
+	got := pending(migrations, []AppliedMigration{{Version: 1}})
+	if len(got) != 2 || got[0].Version != 2 || got[1].Version != 3 {
+		t.Errorf("expected versions 2 and 3 in order, got %+v", got)
+	}
+	if got := pending(migrations, []AppliedMigration{
+		{Version: 1}, {Version: 2}, {Version: 3},
+	}); len(got) != 0 {
+		t.Errorf("expected nothing pending, got %+v", got)
+	}
+}
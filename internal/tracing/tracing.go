@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/reww406/linetracker/config"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const ServiceName = "linetracker"
+
+// NewProvider builds the tracer provider for the configured exporter. The
+// returned shutdown flushes buffered spans and must be called before exit.
+func NewProvider(
+	ctx context.Context, c *config.Configuration,
+) (trace.TracerProvider, func(context.Context) error, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch c.TraceExporter {
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if c.TraceEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(c.TraceEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return noop.NewTracerProvider(), func(context.Context) error {
+			return nil
+		}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf(
+			"failed to create %s trace exporter: %w", c.TraceExporter, err,
+		)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL, semconv.ServiceName(ServiceName),
+		)),
+	)
+	return provider, provider.Shutdown, nil
+}
@@ -0,0 +1,177 @@
+package tracker
+
+import (
+	"math"
+	"sort"
+
+	"github.com/reww406/linetracker/internal/train"
+)
+
+// sighting is one station's prediction for a train.
+type sighting struct {
+	// Position of the station on the route.
+	index   int
+	minutes int8
+}
+
+// chain is one train followed through the predictions of the stations ahead
+// of it in a single poll, nearest station first.
+type chain struct {
+	forward bool
+	// The prediction at the nearest station.
+	train     train.TrainModel
+	sightings []sighting
+}
+
+func (c *chain) last() sighting {
+	return c.sightings[len(c.sightings)-1]
+}
+
+type prediction struct {
+	index       int
+	destination int
+	train       train.TrainModel
+}
+
+// directions decides which way a prediction travels along the route, toward
+// its destination. Trains arriving at their destination are given the
+// direction the rest of their Group travels in.
+func directions(byStation [][]prediction) func(prediction) (forward, ok bool) {
+	votes := map[string]int{}
+	for _, predictions := range byStation {
+		for _, p := range predictions {
+			if p.destination > p.index {
+				votes[p.train.Group]++
+			} else if p.destination < p.index {
+				votes[p.train.Group]--
+			}
+		}
+	}
+	return func(p prediction) (bool, bool) {
+		if p.destination != p.index {
+			return p.destination > p.index, true
+		}
+		vote := votes[p.train.Group]
+		return vote > 0, vote != 0
+	}
+}
+
+// alignment is how a station's predictions continue the open chains: the
+// first offset predictions are trains that entered the segment before the
+// station, the next pairs continue the chains in order.
+type alignment struct {
+	offset   int
+	pairs    int
+	leftover int
+	spread   int
+}
+
+// align picks the alignment that leaves the fewest predictions unexplained
+// behind the last chain and keeps the travel time from the previous station
+// most consistent across chains. A train reaches the next station no sooner
+// than it reaches the current one.
+func align(open []*chain, predictions []prediction) (alignment, bool) {
+	best, found := alignment{}, false
+	for offset := 0; offset <= min(2, len(predictions)); offset++ {
+		pairs := min(len(open), len(predictions)-offset)
+		if pairs == 0 {
+			continue
+		}
+		lo, hi, valid := math.MaxInt, math.MinInt, true
+		for j := 0; j < pairs; j++ {
+			diff := int(predictions[offset+j].train.Minutes) - int(open[j].last().minutes)
+			if diff < 0 {
+				valid = false
+				break
+			}
+			lo, hi = min(lo, diff), max(hi, diff)
+		}
+		if !valid {
+			continue
+		}
+		candidate := alignment{
+			offset:   offset,
+			pairs:    pairs,
+			leftover: len(predictions) - offset - pairs,
+			spread:   hi - lo,
+		}
+		if !found || candidate.leftover < best.leftover ||
+			(candidate.leftover == best.leftover && candidate.spread < best.spread) {
+			best, found = candidate, true
+		}
+	}
+	return best, found
+}
+
+// correlate follows every train on route through one poll's predictions.
+// Stations are walked in each direction of travel and, per destination, a
+// station's predictions either continue the chains of the previous station
+// or start new ones for trains between the two stations.
+func correlate(route Route, locations map[string][]train.TrainModel) []*chain {
+	index := route.index()
+	byStation := make([][]prediction, len(route.Stations))
+	for locationCode, trains := range locations {
+		i, ok := index[locationCode]
+		if !ok {
+			continue
+		}
+		for _, t := range trains {
+			destination, ok := index[t.DestinationCode]
+			if !ok || t.LineCode != string(route.LineCode) ||
+				t.Minutes == train.UnknownMinutes {
+				continue
+			}
+			byStation[i] = append(byStation[i], prediction{i, destination, t})
+		}
+	}
+	direction := directions(byStation)
+
+	var result []*chain
+	for _, forward := range []bool{true, false} {
+		open := map[string][]*chain{}
+		for step := range route.Stations {
+			i := step
+			if !forward {
+				i = len(route.Stations) - 1 - step
+			}
+
+			byDestination := map[string][]prediction{}
+			for _, p := range byStation[i] {
+				if f, ok := direction(p); ok && f == forward {
+					code := p.train.DestinationCode
+					byDestination[code] = append(byDestination[code], p)
+				}
+			}
+
+			next := map[string][]*chain{}
+			for destination, predictions := range byDestination {
+				sort.SliceStable(predictions, func(a, b int) bool {
+					return predictions[a].train.Minutes < predictions[b].train.Minutes
+				})
+				chains := open[destination]
+				a, ok := align(chains, predictions)
+				if !ok {
+					a = alignment{offset: len(predictions)}
+				}
+				for j, p := range predictions {
+					s := sighting{index: i, minutes: p.train.Minutes}
+					if j >= a.offset && j < a.offset+a.pairs {
+						c := chains[j-a.offset]
+						c.sightings = append(c.sightings, s)
+						next[destination] = append(next[destination], c)
+						continue
+					}
+					c := &chain{forward: forward, train: p.train, sightings: []sighting{s}}
+					result = append(result, c)
+					next[destination] = append(next[destination], c)
+				}
+				sort.SliceStable(next[destination], func(a, b int) bool {
+					return next[destination][a].last().minutes <
+						next[destination][b].last().minutes
+				})
+			}
+			open = next
+		}
+	}
+	return result
+}
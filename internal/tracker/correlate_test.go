@@ -0,0 +1,139 @@
+package tracker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/train"
+	"github.com/sirupsen/logrus"
+)
+
+var route = Route{
+	LineCode: "OR",
+	Stations: []RouteStation{
+		{Code: "K08", Name: "Vienna"},
+		{Code: "K07", Name: "Dunn Loring"},
+		{Code: "K06", Name: "West Falls Church"},
+		{Code: "K05", Name: "East Falls Church"},
+		{Code: "K04", Name: "Ballston"},
+	},
+}
+
+// toBallston is a prediction at locationCode for a train heading to K04.
+func toBallston(locationCode string, minutes int8) train.TrainModel {
+	return train.TrainModel{
+		LineCode:        "OR",
+		LocationCode:    locationCode,
+		DestinationCode: "K04",
+		Group:           "1",
+		Minutes:         minutes,
+	}
+}
+
+func locations(trains ...train.TrainModel) map[string][]train.TrainModel {
+	result := map[string][]train.TrainModel{}
+	for _, t := range trains {
+		result[t.LocationCode] = append(result[t.LocationCode], t)
+	}
+	return result
+}
+
+func heads(chains []*chain) []sighting {
+	result := make([]sighting, len(chains))
+	for i, c := range chains {
+		result[i] = c.sightings[0]
+	}
+	return result
+}
+
+func TestCorrelateFollowsTrainsDownTheLine(t *testing.T) {
+	chains := correlate(route, locations(
+		// A boarding at Vienna, B between Dunn Loring and West Falls Church.
+		toBallston("K08", 0),
+		toBallston("K07", 3),
+		toBallston("K06", 2), toBallston("K06", 6),
+		toBallston("K05", 5), toBallston("K05", 9),
+		// Arriving at its destination, direction comes from its Group.
+		toBallston("K04", 8), toBallston("K04", 12),
+		// Another line is ignored.
+		train.TrainModel{LineCode: "SV", LocationCode: "K05", DestinationCode: "K04", Minutes: 1},
+	))
+
+	got := heads(chains)
+	want := []sighting{{index: 0, minutes: 0}, {index: 2, minutes: 2}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("expected heads %+v, got %+v", want, got)
+	}
+	if n := len(chains[0].sightings); n != 5 {
+		t.Errorf("expected the Vienna train at every station, got %d", n)
+	}
+	if n := len(chains[1].sightings); n != 3 {
+		t.Errorf("expected the second train at three stations, got %d", n)
+	}
+	if !chains[0].forward || !chains[1].forward {
+		t.Errorf("expected both trains to travel toward Ballston")
+	}
+}
+
+func TestTrackerKeepsRunsAcrossPolls(t *testing.T) {
+	tracker := NewTracker(nil, logrus.New())
+	polled := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	first := tracker.match("OR", nil, correlate(route, locations(
+		toBallston("K07", 1), toBallston("K06", 4), toBallston("K05", 7),
+	)), polled)
+	// A minute later the train is boarding at Dunn Loring and a new train
+	// appears at Vienna.
+	second := tracker.match("OR", first, correlate(route, locations(
+		toBallston("K08", 2),
+		toBallston("K07", 0), toBallston("K07", 5),
+		toBallston("K06", 3), toBallston("K05", 6),
+	)), polled.Add(time.Minute))
+
+	if len(first) != 1 || len(second) != 2 {
+		t.Fatalf("expected 1 then 2 runs, got %d and %d", len(first), len(second))
+	}
+	var kept *run
+	for _, r := range second {
+		if r.chain.sightings[0].index == 1 {
+			kept = r
+		}
+	}
+	if kept == nil || kept.id != first[0].id || !kept.firstSeen.Equal(polled) {
+		t.Errorf("expected run %s to continue at Dunn Loring, got %+v", first[0].id, second)
+	}
+	for _, r := range second {
+		if r != kept && r.id == first[0].id {
+			t.Errorf("expected the new train to get a new run id")
+		}
+	}
+}
+
+func TestTrackerPositionsUseStoredRoutes(t *testing.T) {
+	// No Metro client, positions must not fetch routes.
+	tracker := NewTracker(&Routes{
+		routes: map[metro.LineCode]Route{"OR": route},
+	}, logrus.New())
+
+	if got, err := tracker.Positions("OR"); err != nil || len(got) != 0 {
+		t.Errorf("expected no positions before the first poll, got %+v %v", got, err)
+	}
+	err := tracker.HandleSnapshot(context.Background(), train.PredictionSnapshot{
+		Timestamp: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+		Locations: locations(toBallston("K07", 1), toBallston("K06", 4)),
+	})
+	if err != nil {
+		t.Errorf("expected lines without a route to only be logged, got %v", err)
+	}
+
+	got, err := tracker.Positions("OR")
+	if err != nil || len(got) != 1 || got[0].NextStationCode != "K07" {
+		t.Errorf("expected one train heading to Dunn Loring, got %+v %v", got, err)
+	}
+	if _, err := tracker.Positions("XX"); apperror.CodeOf(err) != apperror.CodeNotFound {
+		t.Errorf("expected not found for an unknown line, got %v", err)
+	}
+}
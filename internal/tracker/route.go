@@ -0,0 +1,205 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/sirupsen/logrus"
+)
+
+type lineList struct {
+	Lines []lineData `json:"Lines"`
+}
+
+type lineData struct {
+	LineCode         metro.LineCode `json:"LineCode"`
+	StartStationCode string         `json:"StartStationCode"`
+	EndStationCode   string         `json:"EndStationCode"`
+}
+
+type pathList struct {
+	Path []pathData `json:"Path"`
+}
+
+type pathData struct {
+	SeqNum      int    `json:"SeqNum"`
+	StationCode string `json:"StationCode"`
+	StationName string `json:"StationName"`
+}
+
+type RouteStation struct {
+	Code string
+	Name string
+}
+
+// Route is a line's stations in order from its start to its end station.
+type Route struct {
+	LineCode metro.LineCode
+	Stations []RouteStation
+}
+
+// index maps station codes to their position on the route.
+func (r Route) index() map[string]int {
+	result := make(map[string]int, len(r.Stations))
+	for i, station := range r.Stations {
+		result[station.Code] = i
+	}
+	return result
+}
+
+// How long a failed load is returned before the Metro API is asked again.
+const loadRetryBackoff = time.Minute
+
+// Routes fetches every line's route from the Metro API and keeps it for the
+// refresh interval, routes only change with the timetable.
+type Routes struct {
+	metro  *metro.Client
+	config *config.Configuration
+	log    *logrus.Logger
+	// 0 keeps the first routes fetched.
+	refresh time.Duration
+
+	// Held while loading so concurrent callers share one load.
+	loadMu sync.Mutex
+	// Guards the fields below, never held across Metro API calls.
+	mu       sync.Mutex
+	routes   map[metro.LineCode]Route
+	loadedAt time.Time
+	failedAt time.Time
+	err      error
+}
+
+func NewRoutes(
+	c *config.Configuration, metroClient *metro.Client, log *logrus.Logger,
+) *Routes {
+	return &Routes{
+		metro:   metroClient,
+		config:  c,
+		log:     log,
+		refresh: c.StationRefresh,
+	}
+}
+
+func (r *Routes) getLines(ctx context.Context) (map[metro.LineCode]lineData, error) {
+	body, err := r.metro.Get(ctx, r.config.GetLineAPI())
+	if err != nil {
+		return nil, fmt.Errorf("failed to request lines: %w", err)
+	}
+	var lines lineList
+	if err := json.Unmarshal(body, &lines); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal line list: %w", err)
+	}
+	result := make(map[metro.LineCode]lineData, len(lines.Lines))
+	for _, line := range lines.Lines {
+		result[line.LineCode] = line
+	}
+	return result, nil
+}
+
+func (r *Routes) getPath(ctx context.Context, line lineData) (Route, error) {
+	body, err := r.metro.Get(ctx, r.config.GetPathAPI(
+		line.StartStationCode, line.EndStationCode,
+	))
+	if err != nil {
+		return Route{}, fmt.Errorf(
+			"failed to request path for line code: %s: %w", line.LineCode, err,
+		)
+	}
+	var path pathList
+	if err := json.Unmarshal(body, &path); err != nil {
+		return Route{}, fmt.Errorf("failed to unmarshal path: %w", err)
+	}
+	sort.Slice(path.Path, func(i, j int) bool {
+		return path.Path[i].SeqNum < path.Path[j].SeqNum
+	})
+
+	route := Route{LineCode: line.LineCode}
+	for _, station := range path.Path {
+		route.Stations = append(route.Stations, RouteStation{
+			Code: station.StationCode,
+			Name: station.StationName,
+		})
+	}
+	return route, nil
+}
+
+// cached returns the routes, or the last fetch's error, while no fetch is
+// due. Routes that failed to refresh are kept until a fetch succeeds.
+func (r *Routes) cached() (map[metro.LineCode]Route, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.failedAt.IsZero() && time.Since(r.failedAt) < loadRetryBackoff {
+		if r.routes != nil {
+			return r.routes, true, nil
+		}
+		return nil, true, r.err
+	}
+	if r.routes != nil &&
+		(r.refresh <= 0 || time.Since(r.loadedAt) < r.refresh) {
+		return r.routes, true, nil
+	}
+	return nil, false, nil
+}
+
+// fetch requests the lines and then each line's path.
+func (r *Routes) fetch(ctx context.Context) (map[metro.LineCode]Route, error) {
+	lines, err := r.getLines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[metro.LineCode]Route, len(lines))
+	for lineCode, line := range lines {
+		route, err := r.getPath(ctx, line)
+		if err != nil {
+			return nil, err
+		}
+		result[lineCode] = route
+	}
+	return result, nil
+}
+
+// All returns every line's route, fetching them on first use and again once
+// they are older than the refresh interval. A failed fetch is retried once
+// loadRetryBackoff has passed.
+func (r *Routes) All(ctx context.Context) (map[metro.LineCode]Route, error) {
+	if routes, ok, err := r.cached(); ok {
+		return routes, err
+	}
+
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+	// Another caller may have finished loading while this one waited.
+	if routes, ok, err := r.cached(); ok {
+		return routes, err
+	}
+
+	routes, err := r.fetch(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.failedAt = time.Now()
+		r.err = err
+		if r.routes == nil {
+			return nil, err
+		}
+		r.log.WithContext(ctx).WithError(err).Warn(
+			"failed to refresh line routes, keeping the previous ones.",
+		)
+		return r.routes, nil
+	}
+	r.routes = routes
+	r.loadedAt = time.Now()
+	r.failedAt = time.Time{}
+	r.err = nil
+
+	r.log.WithContext(ctx).WithFields(logrus.Fields{
+		"lines": len(routes),
+	}).Info("line routes fetched.")
+	return routes, nil
+}
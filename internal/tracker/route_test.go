@@ -0,0 +1,86 @@
+package tracker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRoutesBackOffAfterFailureAndRefresh(t *testing.T) {
+	var requests atomic.Int32
+	var failing atomic.Bool
+	failing.Store(true)
+	api := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			switch {
+			case failing.Load():
+				w.WriteHeader(http.StatusInternalServerError)
+			case r.URL.Query().Has("FromStationCode"):
+				_, _ = w.Write([]byte(`{"Path": [
+					{"SeqNum": 2, "StationCode": "K07", "StationName": "Dunn Loring"},
+					{"SeqNum": 1, "StationCode": "K08", "StationName": "Vienna"}
+				]}`))
+			default:
+				_, _ = w.Write([]byte(`{"Lines": [
+					{"LineCode": "OR", "StartStationCode": "K08", "EndStationCode": "K07"}
+				]}`))
+			}
+		},
+	))
+	defer api.Close()
+
+	c := &config.Configuration{APIEndpoint: api.URL, Client: api.Client()}
+	routes := NewRoutes(
+		c, metro.NewClient(c, logrus.New(), nil, noop.NewTracerProvider()),
+		logrus.New(),
+	)
+	ctx := context.Background()
+
+	if _, err := routes.All(ctx); err == nil {
+		t.Fatal("expected the first load to fail")
+	}
+	if _, err := routes.All(ctx); err == nil || requests.Load() != 1 {
+		t.Fatalf("expected the failure to be reused, got %v after %d requests",
+			err, requests.Load())
+	}
+
+	failing.Store(false)
+	routes.failedAt = time.Now().Add(-loadRetryBackoff)
+	all, err := routes.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route := all["OR"]; len(route.Stations) != 2 || route.Stations[0].Code != "K08" {
+		t.Errorf("expected the path in order, got %+v", route)
+	}
+	if _, err := routes.All(ctx); err != nil || requests.Load() != 3 {
+		t.Errorf("expected one lines and one path request, got %d", requests.Load()-1)
+	}
+
+	// Once stale a failed refresh keeps the routes it had.
+	failing.Store(true)
+	routes.refresh = time.Hour
+	routes.loadedAt = time.Now().Add(-2 * time.Hour)
+	if all, err := routes.All(ctx); err != nil || len(all["OR"].Stations) != 2 {
+		t.Errorf("expected the previous routes, got %+v %v", all, err)
+	}
+	if requests.Load() != 4 {
+		t.Errorf("expected one refresh attempt, got %d requests", requests.Load())
+	}
+
+	failing.Store(false)
+	routes.failedAt = time.Now().Add(-loadRetryBackoff)
+	if _, err := routes.All(ctx); err != nil || requests.Load() != 6 {
+		t.Errorf("expected the routes to refresh, got %v after %d requests",
+			err, requests.Load())
+	}
+}
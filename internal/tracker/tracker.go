@@ -0,0 +1,265 @@
+// Package tracker follows individual trains along their line by correlating
+// the independent per station predictions of each poll, and across polls.
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/reww406/linetracker/internal/train"
+	"github.com/sirupsen/logrus"
+)
+
+// matchTolerance is how far apart a run's estimated arrivals at a station
+// may be in consecutive polls and still be the same train.
+const matchTolerance = 2 * time.Minute
+
+var lineCodes = []metro.LineCode{
+	metro.RedLine,
+	metro.OrangeLine,
+	metro.SilverLine,
+	metro.BlueLine,
+	metro.GreenLine,
+	metro.YellowLine,
+}
+
+// Position is where a train run is estimated to be after the latest poll.
+type Position struct {
+	// Identifies the run across polls, not across restarts.
+	RunID           string
+	LineCode        metro.LineCode
+	DestinationCode string
+	DestinationName string
+	Group           string
+	CarCount        int8
+	// Last station passed, empty before the first station of the route.
+	PreviousStationCode string
+	NextStationCode     string
+	NextStationName     string
+	// Until the train reaches NextStationCode, 0 when arriving or boarding.
+	Minutes    int8
+	FirstSeen  time.Time
+	ObservedAt time.Time
+}
+
+// run is a train followed across polls.
+type run struct {
+	id        string
+	chain     *chain
+	firstSeen time.Time
+	// Estimated arrival at every station the train was predicted at, keyed
+	// by route index.
+	arrivals map[int]time.Time
+}
+
+func newArrivals(c *chain, polled time.Time) map[int]time.Time {
+	result := make(map[int]time.Time, len(c.sightings))
+	for _, s := range c.sightings {
+		result[s.index] = polled.Add(time.Duration(s.minutes) * time.Minute)
+	}
+	return result
+}
+
+// distance compares the arrivals both runs estimate at the same stations,
+// false when they share no station.
+func distance(a, b map[int]time.Time) (time.Duration, bool) {
+	best, found := time.Duration(0), false
+	for index, at := range a {
+		other, ok := b[index]
+		if !ok {
+			continue
+		}
+		d := at.Sub(other)
+		if d < 0 {
+			d = -d
+		}
+		if !found || d < best {
+			best, found = d, true
+		}
+	}
+	return best, found
+}
+
+type lineState struct {
+	route      Route
+	runs       []*run
+	observedAt time.Time
+}
+
+// Tracker keeps the runs of every line from the latest poll.
+type Tracker struct {
+	routes *Routes
+	log    *logrus.Logger
+
+	mu     sync.Mutex
+	lines  map[metro.LineCode]*lineState
+	nextID int64
+}
+
+func NewTracker(routes *Routes, log *logrus.Logger) *Tracker {
+	return &Tracker{
+		routes: routes,
+		log:    log,
+		lines:  make(map[metro.LineCode]*lineState),
+	}
+}
+
+// match carries previous runs over to this poll's chains, closest estimated
+// arrivals first. Chains left over start new runs.
+func (t *Tracker) match(
+	lineCode metro.LineCode, previous []*run, chains []*chain, polled time.Time,
+) []*run {
+	type pair struct {
+		prev, cur int
+		distance  time.Duration
+	}
+	current := make([]*run, len(chains))
+	for i, c := range chains {
+		current[i] = &run{chain: c, firstSeen: polled, arrivals: newArrivals(c, polled)}
+	}
+
+	var pairs []pair
+	for i, prev := range previous {
+		for j, cur := range current {
+			if prev.chain.forward != cur.chain.forward ||
+				prev.chain.train.DestinationCode != cur.chain.train.DestinationCode {
+				continue
+			}
+			d, ok := distance(prev.arrivals, cur.arrivals)
+			if ok && d <= matchTolerance {
+				pairs = append(pairs, pair{i, j, d})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool {
+		return pairs[a].distance < pairs[b].distance
+	})
+
+	usedPrev := make([]bool, len(previous))
+	for _, p := range pairs {
+		if usedPrev[p.prev] || current[p.cur].id != "" {
+			continue
+		}
+		usedPrev[p.prev] = true
+		current[p.cur].id = previous[p.prev].id
+		current[p.cur].firstSeen = previous[p.prev].firstSeen
+	}
+	for _, r := range current {
+		if r.id == "" {
+			t.nextID++
+			r.id = fmt.Sprintf("%s-%d", lineCode, t.nextID)
+		}
+	}
+	return current
+}
+
+// HandleSnapshot is an EventBus Handler that correlates the snapshot's
+// predictions on every line. A poll that reached no station leaves the
+// previous positions in place. Problems are logged rather than returned, the
+// poll itself succeeded.
+func (t *Tracker) HandleSnapshot(
+	ctx context.Context, event train.PredictionSnapshot,
+) error {
+	if len(event.Locations) == 0 {
+		return nil
+	}
+
+	routes, err := t.routes.All(ctx)
+	if err != nil {
+		t.log.WithContext(ctx).WithError(err).Warn(
+			"failed to get line routes, positions not updated.",
+		)
+		return nil
+	}
+
+	for _, lineCode := range lineCodes {
+		route, ok := routes[lineCode]
+		if !ok {
+			t.log.WithContext(ctx).WithField("line_code", lineCode).Warn(
+				"no route for line, positions not updated.",
+			)
+			continue
+		}
+		chains := correlate(route, event.Locations)
+
+		t.mu.Lock()
+		var previous []*run
+		if state, ok := t.lines[lineCode]; ok {
+			previous = state.runs
+		}
+		t.lines[lineCode] = &lineState{
+			route:      route,
+			runs:       t.match(lineCode, previous, chains, event.Timestamp),
+			observedAt: event.Timestamp,
+		}
+		t.mu.Unlock()
+
+		t.log.WithContext(ctx).WithFields(logrus.Fields{
+			"line_code": lineCode,
+			"runs":      len(chains),
+		}).Debug("train runs tracked.")
+	}
+	return nil
+}
+
+// Positions returns every run on lineCode from the latest poll in each
+// direction of travel, ordered along the route.
+func (t *Tracker) Positions(lineCode metro.LineCode) ([]Position, error) {
+	// Fails for unknown lines even before the first poll.
+	if !slices.Contains(lineCodes, lineCode) {
+		return nil, apperror.NotFound(fmt.Sprintf(
+			"unknown line code: %s", lineCode,
+		))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.lines[lineCode]
+	if !ok {
+		return []Position{}, nil
+	}
+
+	runs := append([]*run(nil), state.runs...)
+	sort.SliceStable(runs, func(a, b int) bool {
+		ca, cb := runs[a].chain, runs[b].chain
+		if ca.forward != cb.forward {
+			return ca.forward
+		}
+		if ca.sightings[0].index != cb.sightings[0].index {
+			return (ca.sightings[0].index > cb.sightings[0].index) == ca.forward
+		}
+		return ca.sightings[0].minutes < cb.sightings[0].minutes
+	})
+
+	result := make([]Position, len(runs))
+	for i, r := range runs {
+		head := r.chain.sightings[0]
+		previous := ""
+		if p := head.index - 1; r.chain.forward && p >= 0 {
+			previous = state.route.Stations[p].Code
+		} else if p := head.index + 1; !r.chain.forward && p < len(state.route.Stations) {
+			previous = state.route.Stations[p].Code
+		}
+		result[i] = Position{
+			RunID:               r.id,
+			LineCode:            lineCode,
+			DestinationCode:     r.chain.train.DestinationCode,
+			DestinationName:     r.chain.train.DestinationName,
+			Group:               r.chain.train.Group,
+			CarCount:            r.chain.train.CarCount,
+			PreviousStationCode: previous,
+			NextStationCode:     state.route.Stations[head.index].Code,
+			NextStationName:     state.route.Stations[head.index].Name,
+			Minutes:             head.minutes,
+			FirstSeen:           r.firstSeen,
+			ObservedAt:          state.observedAt,
+		}
+	}
+	return result, nil
+}
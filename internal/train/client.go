@@ -1,30 +1,15 @@
 package train
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-
-	"github.com/reww406/linetracker/config"
-	"github.com/reww406/linetracker/internal/metro"
 )
 
-var log = config.GetLogger()
-
-func requestTrains() ([]byte, error) {
-	config := config.LoadConfig()
-
-	req, err := metro.GetRequest(config.GetTrainAPI(), config.APIKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create train req: %w", err)
-	}
-
-	return metro.ExecuteRequest(req)
-}
-
-func getTrains() (*trainList, error) {
-	body, err := requestTrains()
+func (p *Poller) getTrains(ctx context.Context) (*trainList, error) {
+	body, err := p.metro.Get(ctx, p.trainAPI)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get trains from Metro API: %w", err)
+		return nil, fmt.Errorf("failed to request trains: %w", err)
 	}
 
 	var trains trainList
@@ -32,7 +17,7 @@ func getTrains() (*trainList, error) {
 		return nil, fmt.Errorf("failed to unmarshal train list: %w", err)
 	}
 
-	log.WithField("trains", len(trains.TrainPredictions)).Info(
+	p.log.WithContext(ctx).WithField("trains", len(trains.TrainPredictions)).Info(
 		"train predictions returned from API.",
 	)
 
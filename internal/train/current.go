@@ -0,0 +1,121 @@
+package train
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/sirupsen/logrus"
+)
+
+// Global secondary indexes on the trains table, both sorted by
+// createdEpochMs.
+const (
+	LineIndex        = "lineCode-createdEpochMs"
+	DestinationIndex = "destinationCode-createdEpochMs"
+)
+
+// How far back to look for the latest poll, a few poll intervals.
+const currentWindow = time.Minute
+
+// CurrentTrainsRequest selects the predictions from the latest poll for a
+// line, a destination or both.
+type CurrentTrainsRequest struct {
+	LineCode        metro.LineCode
+	DestinationCode string
+}
+
+// GetCurrentTrains returns the latest poll's predictions for every station
+// on the requested line or heading to the requested destination. Queries
+// with a destination use DestinationIndex and filter on the line, the
+// handful of trains to the same destination on another line are the only
+// rows read and discarded.
+func (r *Repository) GetCurrentTrains(
+	ctx context.Context, request CurrentTrainsRequest,
+) ([]TrainModel, error) {
+	since := expression.Key("createdEpochMs").GreaterThanEqual(
+		expression.Value(time.Now().Add(-currentWindow).UnixMilli()),
+	)
+
+	var index string
+	var builder expression.Builder
+	switch {
+	case request.DestinationCode != "":
+		index = DestinationIndex
+		builder = expression.NewBuilder().WithKeyCondition(
+			expression.Key("destinationCode").
+				Equal(expression.Value(request.DestinationCode)).And(since),
+		)
+		if request.LineCode != "" {
+			builder = builder.WithFilter(expression.Name("lineCode").
+				Equal(expression.Value(request.LineCode)))
+		}
+	case request.LineCode != "":
+		index = LineIndex
+		builder = expression.NewBuilder().WithKeyCondition(
+			expression.Key("lineCode").
+				Equal(expression.Value(request.LineCode)).And(since),
+		)
+	default:
+		return nil, apperror.InvalidArgument(
+			"line_code or destination_code is required",
+		)
+	}
+
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build ddb expression %w", err)
+	}
+
+	paginator := dynamodb.NewQueryPaginator(r.client, &dynamodb.QueryInput{
+		TableName:                 r.tableName,
+		IndexName:                 aws.String(index),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	var trains []TrainModel
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, apperror.Store("failed to query trains", err)
+		}
+		for _, item := range page.Items {
+			train, err := itemToDdbTrain(item)
+			if err != nil {
+				return nil, err
+			}
+			trains = append(trains, train)
+		}
+	}
+
+	trains = LatestPoll(trains)
+	r.log.WithContext(ctx).WithFields(logrus.Fields{
+		"index":      index,
+		"result_len": len(trains),
+	}).Info("current trains found.")
+	return trains, nil
+}
+
+// LatestPoll keeps the trains stamped by the most recent poll, dropping
+// older predictions still within the retention window.
+func LatestPoll(trains []TrainModel) []TrainModel {
+	var newest int64
+	for _, train := range trains {
+		newest = max(newest, train.CreatedEpochMs)
+	}
+
+	result := make([]TrainModel, 0, len(trains))
+	for _, train := range trains {
+		if train.CreatedEpochMs == newest {
+			result = append(result, train)
+		}
+	}
+	return result
+}
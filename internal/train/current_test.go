@@ -0,0 +1,21 @@
+package train
+
+import "testing"
+
+func TestLatestPollKeepsNewestSnapshot(t *testing.T) {
+	trains := []TrainModel{
+		{LocationCode: "D01", CreatedEpochMs: 1_000},
+		{LocationCode: "D02", CreatedEpochMs: 21_000},
+		{LocationCode: "D01", CreatedEpochMs: 21_000},
+		{LocationCode: "D03", CreatedEpochMs: 11_000},
+	}
+
+	got := LatestPoll(trains)
+	if len(got) != 2 || got[0].LocationCode != "D02" ||
+		got[1].LocationCode != "D01" {
+		t.Errorf("expected the two trains from the last poll, got %+v", got)
+	}
+	if got := LatestPoll(nil); len(got) != 0 {
+		t.Errorf("expected no trains, got %+v", got)
+	}
+}
@@ -0,0 +1,108 @@
+package train
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PredictionSnapshot is published once per poll of the Metro API.
+type PredictionSnapshot struct {
+	Timestamp time.Time
+	// Predictions keyed by location code.
+	Locations map[string][]TrainModel
+	// Anything that went wrong while polling, Locations is empty when the
+	// Metro API could not be reached.
+	Errors []error
+}
+
+// ID identifies the snapshot to clients, it increases with every poll.
+func (ps PredictionSnapshot) ID() int64 {
+	return ps.Timestamp.UnixMilli()
+}
+
+// Trains returns the predictions for every location.
+func (ps PredictionSnapshot) Trains() []TrainModel {
+	var result []TrainModel
+	for _, trains := range ps.Locations {
+		result = append(result, trains...)
+	}
+	return result
+}
+
+func newPredictionSnapshot(
+	timestamp time.Time, trains []TrainModel,
+) PredictionSnapshot {
+	locations := make(map[string][]TrainModel)
+	for _, train := range trains {
+		locations[train.LocationCode] = append(
+			locations[train.LocationCode], train,
+		)
+	}
+	return PredictionSnapshot{
+		Timestamp: timestamp,
+		Locations: locations,
+	}
+}
+
+// Handler reacts to a snapshot, returned errors are reported back to the
+// poller.
+type Handler func(ctx context.Context, event PredictionSnapshot) error
+
+type subscription struct {
+	id      int
+	handler Handler
+}
+
+// EventBus delivers every PredictionSnapshot to its subscribers in the order
+// they subscribed, so storage can be registered ahead of anything that
+// expects the snapshot to be persisted.
+type EventBus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   []subscription
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe registers handler and returns a func that removes it.
+func (b *EventBus) Subscribe(handler Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.subs = append(b.subs, subscription{id: id, handler: handler})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, sub := range b.subs {
+			if sub.id == id {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish calls every handler even if an earlier one fails and returns the
+// joined errors.
+func (b *EventBus) Publish(
+	ctx context.Context, event PredictionSnapshot,
+) error {
+	b.mu.RLock()
+	subs := make([]subscription, len(b.subs))
+	copy(subs, b.subs)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, sub := range subs {
+		if err := sub.handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,59 @@
+package train
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEventBusDeliversInOrderAndJoinsErrors(t *testing.T) {
+	bus := NewEventBus()
+	var calls []string
+
+	bus.Subscribe(func(context.Context, PredictionSnapshot) error {
+		calls = append(calls, "store")
+		return errors.New("store failed")
+	})
+	unsubscribe := bus.Subscribe(func(context.Context, PredictionSnapshot) error {
+		calls = append(calls, "removed")
+		return nil
+	})
+	bus.Subscribe(func(context.Context, PredictionSnapshot) error {
+		calls = append(calls, "stream")
+		return nil
+	})
+	unsubscribe()
+
+	err := bus.Publish(context.Background(), PredictionSnapshot{})
+	if err == nil || err.Error() != "store failed" {
+		t.Fatalf("expected store error, got %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "store" || calls[1] != "stream" {
+		t.Fatalf("unexpected handler calls %v", calls)
+	}
+}
+
+func TestFeedPublishesPerLocation(t *testing.T) {
+	feed := NewFeed()
+	updates, unsubscribe := feed.Subscribe("K08")
+	defer unsubscribe()
+
+	event := newPredictionSnapshot(time.UnixMilli(1000), []TrainModel{
+		{LocationCode: "K08", LineCode: "OR"},
+		{LocationCode: "A01", LineCode: "RD"},
+	})
+	if err := feed.HandleSnapshot(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := <-updates
+	if snapshot.ID != 1000 || len(snapshot.Trains) != 1 ||
+		snapshot.Trains[0].LineCode != "OR" {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	if latest, ok := feed.Latest("A01"); !ok || len(latest.Trains) != 1 {
+		t.Fatalf("expected latest snapshot for A01, got %+v", latest)
+	}
+}
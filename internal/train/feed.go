@@ -0,0 +1,115 @@
+package train
+
+import (
+	"context"
+	"sync"
+)
+
+// Snapshot is the set of predictions a single poll wrote for one location.
+type Snapshot struct {
+	// Epoch ms the poll completed, increases with every poll.
+	ID           int64
+	LocationCode string
+	Trains       []TrainModel
+}
+
+// Feed notifies listeners of the predictions published by each poll, grouped
+// by location code. The latest snapshot per location is kept so new
+// listeners do not have to wait for the next poll.
+type Feed struct {
+	mu     sync.Mutex
+	subs   map[string]map[chan Snapshot]struct{}
+	latest map[string]Snapshot
+}
+
+func NewFeed() *Feed {
+	return &Feed{
+		subs:   make(map[string]map[chan Snapshot]struct{}),
+		latest: make(map[string]Snapshot),
+	}
+}
+
+// Subscribe returns a channel receiving every new snapshot for locationCode
+// and a func that must be called to stop receiving.
+func (f *Feed) Subscribe(locationCode string) (<-chan Snapshot, func()) {
+	ch := make(chan Snapshot, 1)
+
+	f.mu.Lock()
+	if f.subs[locationCode] == nil {
+		f.subs[locationCode] = make(map[chan Snapshot]struct{})
+	}
+	f.subs[locationCode][ch] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			delete(f.subs[locationCode], ch)
+			if len(f.subs[locationCode]) == 0 {
+				delete(f.subs, locationCode)
+			}
+		})
+	}
+}
+
+// Latest returns the most recent snapshot published for locationCode.
+func (f *Feed) Latest(locationCode string) (Snapshot, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	snapshot, ok := f.latest[locationCode]
+	return snapshot, ok
+}
+
+// HandleSnapshot is an EventBus Handler that hands each listener the newest
+// snapshot for its location, a slow listener only ever misses intermediate
+// snapshots. Locations the poll left out no longer have trains, they get one
+// empty snapshot. Failed polls are skipped so listeners keep what they had.
+func (f *Feed) HandleSnapshot(
+	ctx context.Context, event PredictionSnapshot,
+) error {
+	if len(event.Locations) == 0 && len(event.Errors) > 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for locationCode, locationTrains := range event.Locations {
+		f.send(Snapshot{
+			ID:           event.ID(),
+			LocationCode: locationCode,
+			Trains:       locationTrains,
+		})
+	}
+
+	var emptied []string
+	for locationCode, snapshot := range f.latest {
+		if _, ok := event.Locations[locationCode]; !ok && len(snapshot.Trains) > 0 {
+			emptied = append(emptied, locationCode)
+		}
+	}
+	for locationCode := range f.subs {
+		_, polled := event.Locations[locationCode]
+		if _, seen := f.latest[locationCode]; !polled && !seen {
+			emptied = append(emptied, locationCode)
+		}
+	}
+	for _, locationCode := range emptied {
+		f.send(Snapshot{ID: event.ID(), LocationCode: locationCode})
+	}
+	return nil
+}
+
+// send records snapshot as the latest for its location and hands it to the
+// location's listeners, f.mu must be held.
+func (f *Feed) send(snapshot Snapshot) {
+	f.latest[snapshot.LocationCode] = snapshot
+	for ch := range f.subs[snapshot.LocationCode] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- snapshot
+	}
+}
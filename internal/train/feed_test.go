@@ -0,0 +1,108 @@
+package train
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFeedFansOutAndUnsubscribes(t *testing.T) {
+	feed := NewFeed()
+	first, unsubscribeFirst := feed.Subscribe("K08")
+	second, unsubscribeSecond := feed.Subscribe("K08")
+	defer unsubscribeSecond()
+
+	publish := func(ms int64) {
+		event := newPredictionSnapshot(time.UnixMilli(ms), []TrainModel{
+			{LocationCode: "K08", LineCode: "OR"},
+		})
+		if err := feed.HandleSnapshot(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publish(1000)
+	for _, updates := range []<-chan Snapshot{first, second} {
+		if snapshot := <-updates; snapshot.ID != 1000 {
+			t.Errorf("expected snapshot 1000, got %+v", snapshot)
+		}
+	}
+
+	unsubscribeFirst()
+	// Calling it twice is harmless.
+	unsubscribeFirst()
+	publish(2000)
+	select {
+	case snapshot := <-first:
+		t.Errorf("expected no snapshot after unsubscribe, got %+v", snapshot)
+	default:
+	}
+	if snapshot := <-second; snapshot.ID != 2000 {
+		t.Errorf("expected snapshot 2000, got %+v", snapshot)
+	}
+}
+
+func TestFeedKeepsOnlyNewestForSlowListener(t *testing.T) {
+	feed := NewFeed()
+	updates, unsubscribe := feed.Subscribe("K08")
+	defer unsubscribe()
+
+	for _, ms := range []int64{1000, 2000, 3000} {
+		event := newPredictionSnapshot(time.UnixMilli(ms), []TrainModel{
+			{LocationCode: "K08"},
+		})
+		if err := feed.HandleSnapshot(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if snapshot := <-updates; snapshot.ID != 3000 {
+		t.Errorf("expected the newest snapshot, got %+v", snapshot)
+	}
+}
+
+func TestFeedEmptiesLocationsLeftOutOfAPoll(t *testing.T) {
+	feed := NewFeed()
+	updates, unsubscribe := feed.Subscribe("K08")
+	defer unsubscribe()
+
+	publish := func(event PredictionSnapshot) {
+		if err := feed.HandleSnapshot(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publish(newPredictionSnapshot(time.UnixMilli(1000), []TrainModel{
+		{LocationCode: "K08"}, {LocationCode: "K07"},
+	}))
+	if snapshot := <-updates; len(snapshot.Trains) != 1 {
+		t.Fatalf("expected K08's train, got %+v", snapshot)
+	}
+
+	// A failed poll leaves the trains in place.
+	publish(PredictionSnapshot{
+		Timestamp: time.UnixMilli(1500),
+		Errors:    []error{errors.New("WMATA is down")},
+	})
+	publish(newPredictionSnapshot(time.UnixMilli(2000), []TrainModel{
+		{LocationCode: "K07"},
+	}))
+	snapshot := <-updates
+	if snapshot.ID != 2000 || len(snapshot.Trains) != 0 {
+		t.Errorf("expected an empty snapshot for K08, got %+v", snapshot)
+	}
+	if latest, ok := feed.Latest("K08"); !ok || len(latest.Trains) != 0 {
+		t.Errorf("expected K08 to be empty for new listeners, got %+v", latest)
+	}
+
+	// Nothing more is sent while K08 stays empty.
+	publish(newPredictionSnapshot(time.UnixMilli(3000), []TrainModel{
+		{LocationCode: "K07"},
+	}))
+	select {
+	case snapshot := <-updates:
+		t.Errorf("expected no repeated empty snapshot, got %+v", snapshot)
+	default:
+	}
+}
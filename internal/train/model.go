@@ -1,7 +1,10 @@
 package train
 
 import (
+	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,33 +22,88 @@ type train struct {
 	LocationCode    string `json:"LocationCode"`
 	// Where the train is
 	LocationName string `json:"LocationName"`
-	// How many minutes until it leaves
+	// How many minutes until it leaves, ARR or BRD when it is at the
+	// station and "---" or empty when WMATA has no estimate.
 	Min string `json:"Min"`
 }
 
+// UnknownMinutes is stored for trains WMATA has no estimate for.
+const UnknownMinutes int8 = -1
+
+// parseMinutes turns WMATA's Min into minutes, 0 for arriving and boarding
+// trains.
+func parseMinutes(min string) int8 {
+	switch min {
+	case "ARR", "BRD":
+		return 0
+	}
+	minutes, err := strconv.Atoi(min)
+	if err != nil || minutes < 0 || minutes > math.MaxInt8 {
+		return UnknownMinutes
+	}
+	return int8(minutes)
+}
+
 type trainList struct {
 	TrainPredictions []train `json:"Trains"`
 }
 
 type TrainModel struct {
-	CarCount        int8   `dynamodbav:"carCount"`
-	Destination     string `dynamodbav:"destination"`
-	// Can be null..
-	DestinationCode string `dynamodbav:"destinationCode"`
+	CarCount    int8   `dynamodbav:"carCount"`
+	Destination string `dynamodbav:"destination"`
+	// Can be null. It and LineCode key the indexes, which do not accept
+	// empty strings, so they are left out when empty.
+	DestinationCode string `dynamodbav:"destinationCode,omitempty"`
 	DestinationName string `dynamodbav:"destinationName"`
 	Group           string `dynamodbav:"group"`
-	LineCode        string `dynamodbav:"lineCode"`
+	LineCode        string `dynamodbav:"lineCode,omitempty"`
 	LocationCode    string `dynamodbav:"locationCode"`
 	LocationName    string `dynamodbav:"locationName"`
-	Minutes         int8   `dynamodbav:"minutes"`
-	CreatedEpochMs  int64  `dynamodbav:"createdEpochMs"`
+	// UnknownMinutes when WMATA has no estimate.
+	Minutes int8 `dynamodbav:"minutes"`
+	// When the poll ran, shared by every prediction from it.
+	CreatedEpochMs int64 `dynamodbav:"createdEpochMs"`
+	// Sort key, unique per prediction at a station, see predictionKey.
+	PredictionKey string `dynamodbav:"predictionKey"`
+	// Unix seconds after which DDB's TTL deletes the item, unset when
+	// predictions are kept forever.
+	ExpiresAt int64 `dynamodbav:"expiresAt,omitempty"`
+}
+
+// pollKey is the zero padded poll time every predictionKey of that poll
+// starts with, so keys sort and compare like the number.
+func pollKey(createdEpochMs int64) string {
+	return fmt.Sprintf("%013d", createdEpochMs)
 }
 
-func (tl *trainList) toTrainModels() []TrainModel {
+// PollTime is the poll time a predictionKey starts with.
+func PollTime(predictionKey string) (time.Time, error) {
+	ms, _, _ := strings.Cut(predictionKey, "#")
+	createdEpochMs, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad prediction key %q: %w", predictionKey, err)
+	}
+	return time.UnixMilli(createdEpochMs), nil
+}
+
+// predictionKey orders a station's predictions by poll and then by their
+// position in the poll's group.
+func predictionKey(createdEpochMs int64, group string, seq int) string {
+	return fmt.Sprintf("%s#%s#%03d", pollKey(createdEpochMs), group, seq)
+}
+
+// toTrainModels stamps every prediction with the time of the poll.
+func (tl *trainList) toTrainModels(polled time.Time) []TrainModel {
+	createdEpochMs := polled.UnixMilli()
+	// Predictions seen so far per station and group.
+	seqs := make(map[[2]string]int)
 	result := make([]TrainModel, len(tl.TrainPredictions))
 	for i, train := range tl.TrainPredictions {
+		group := [2]string{train.LocationCode, train.Group}
+		seq := seqs[group]
+		seqs[group]++
+
 		carInt, _ := strconv.Atoi(train.Car)
-		minInt, _ := strconv.Atoi(train.Min)
 		result[i] = TrainModel{
 			CarCount:        int8(carInt),
 			Destination:     train.Destination,
@@ -55,8 +113,9 @@ func (tl *trainList) toTrainModels() []TrainModel {
 			LineCode:        train.Line,
 			LocationCode:    train.LocationCode,
 			LocationName:    train.LocationName,
-			Minutes:         int8(minInt),
-			CreatedEpochMs:  time.Now().UnixMilli(),
+			Minutes:         parseMinutes(train.Min),
+			CreatedEpochMs:  createdEpochMs,
+			PredictionKey:   predictionKey(createdEpochMs, train.Group, seq),
 		}
 	}
 	return result
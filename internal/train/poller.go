@@ -2,29 +2,125 @@ package train
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"	
+	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/job"
+	"github.com/reww406/linetracker/internal/metrics"
+	"github.com/reww406/linetracker/internal/metro"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const PollJobName = "train_poll"
 
-// TODO Needs to fetch trains every 5 seconds between 6AM->6PM.
-// We should implement a Retry
-func PollTrainPredictions(client *dynamodb.Client, openClose [2]int64) {
-	ticker := time.NewTicker(20 * time.Second)
-	defer ticker.Stop()
+// Poller fetches predictions from the Metro API and publishes them to the
+// event bus.
+type Poller struct {
+	metro    *metro.Client
+	trainAPI string
+	bus      *EventBus
+	jobs     *job.Tracker
+	log      *logrus.Logger
+	metrics  *metrics.Metrics
+	tracer   trace.Tracer
+	interval time.Duration
+	// Unix ms when PollTrainPredictions started, 0 while it is not running.
+	startedMs atomic.Int64
+}
 
-	for range ticker.C {
-		log.Info("Fetching train predictions from Metro API.")
+func NewPoller(
+	c *config.Configuration,
+	metroClient *metro.Client,
+	bus *EventBus,
+	jobs *job.Tracker,
+	log *logrus.Logger,
+	m *metrics.Metrics,
+	tp trace.TracerProvider,
+) *Poller {
+	return &Poller{
+		metro:    metroClient,
+		trainAPI: c.GetTrainAPI(),
+		bus:      bus,
+		jobs:     jobs,
+		log:      log,
+		metrics:  m,
+		tracer:   tp.Tracer("github.com/reww406/linetracker/internal/train"),
+		interval: c.PollInterval,
+	}
+}
 
-		trainList, err := getTrains()
+// PollOnce fetches the current predictions from the Metro API and publishes
+// them to the bus, failures to reach the API are published too.
+func (p *Poller) PollOnce(ctx context.Context) (err error) {
+	start := time.Now()
+	predictions := 0
+	ctx, span := p.tracer.Start(ctx, "train.PollOnce")
+	defer func() {
+		p.metrics.ObservePoll(time.Since(start), predictions, err)
+		span.SetAttributes(attribute.Int("predictions", predictions))
 		if err != nil {
-			log.WithError(err).Errorln("failed to get stations from Metro API")
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 		}
+		span.End()
+	}()
 
-		err = InsertTrains(context.Background(), client, *trainList)
-		if err != nil {
-			log.WithError(err).Errorln("failed to insert Trains into DDB")
+	trainList, err := p.getTrains(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to get trains from Metro API: %w", err)
+		event := PredictionSnapshot{
+			Timestamp: time.Now(),
+			Errors:    []error{err},
+		}
+		return errors.Join(err, p.bus.Publish(ctx, event))
+	}
+
+	polled := time.Now()
+	trains := trainList.toTrainModels(polled)
+	predictions = len(trains)
+	return p.bus.Publish(ctx, newPredictionSnapshot(polled, trains))
+}
+
+// RunningSince is when the polling loop started, false while it is not
+// running.
+func (p *Poller) RunningSince() (time.Time, bool) {
+	startedMs := p.startedMs.Load()
+	if startedMs == 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(startedMs), true
+}
+
+// PollTrainPredictions polls right away and then every PollInterval until
+// ctx is done. A poll already in progress is left to finish and is only
+// cancelled by jobs.Shutdown.
+func (p *Poller) PollTrainPredictions(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.startedMs.Store(time.Now().UnixMilli())
+	defer p.startedMs.Store(0)
+
+	for {
+		p.log.Info("Fetching train predictions from Metro API.")
+
+		// TODO We should implement a Retry
+		err := p.jobs.Run(context.WithoutCancel(ctx), PollJobName, p.PollOnce)
+		if err != nil && !errors.Is(err, job.ErrShuttingDown) {
+			p.log.WithError(err).Errorln("failed to poll train predictions")
+		}
+
+		select {
+		case <-ctx.Done():
+			p.log.Info("stopping train poller.")
+			return
+		case <-ticker.C:
 		}
 	}
 }
@@ -3,7 +3,7 @@ package train
 import (
 	"context"
 	"fmt"
-	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -12,6 +12,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 
 	"github.com/reww406/linetracker/config"
+	"github.com/reww406/linetracker/internal/apperror"
+	"github.com/reww406/linetracker/internal/metrics"
 	"github.com/reww406/linetracker/internal/metro"
 	"github.com/sirupsen/logrus"
 )
@@ -22,99 +24,160 @@ type GetNextTrainsRequest struct {
 	Direction    string
 }
 
-// Since TrainList is not a ptr, any changes will not modify the original one.
-func InsertTrains(
-	ctx context.Context, client *dynamodb.Client, trainList trainList,
+// Repository reads and writes train predictions in DDB.
+type Repository struct {
+	client    *dynamodb.Client
+	tableName *string
+	log       *logrus.Logger
+	metrics   *metrics.Metrics
+	retention time.Duration
+	// Unix ms of the last snapshot written, 0 until the first.
+	lastStoredMs atomic.Int64
+}
+
+func NewRepository(
+	client *dynamodb.Client,
+	c *config.Configuration,
+	log *logrus.Logger,
+	m *metrics.Metrics,
+) *Repository {
+	return &Repository{
+		client:    client,
+		tableName: c.PredictionTableName(),
+		log:       log,
+		metrics:   m,
+		retention: c.TrainRetention,
+	}
+}
+
+func (r *Repository) InsertTrains(
+	ctx context.Context, ddbTrains []TrainModel,
 ) error {
-	ddbTrains := trainList.toTrainModels()
-	log.WithFields(logrus.Fields{
+	r.log.WithContext(ctx).WithFields(logrus.Fields{
 		"trains_len": len(ddbTrains),
 	}).Info("Inserting Trains into DDB")
 
 	for _, train := range ddbTrains {
+		if r.retention > 0 {
+			train.ExpiresAt = time.UnixMilli(train.CreatedEpochMs).
+				Add(r.retention).Unix()
+		}
 		item, err := attributevalue.MarshalMap(train)
 		if err != nil {
 			return fmt.Errorf("failed to marshal train: %w", err)
 		}
-		log.WithFields(logrus.Fields{
+		r.log.WithContext(ctx).WithFields(logrus.Fields{
 			"train": train,
 		}).Info("inserting train.")
-		_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
-			TableName: config.TrainTableName,
+		_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: r.tableName,
 			Item:      item,
 		})
 		if err != nil {
-			return fmt.Errorf(
-				"failed to insert train with location code: %s created: %d with error: %w",
-				train.LocationCode, train.CreatedEpochMs, err,
-			)
+			return apperror.Store(fmt.Sprintf(
+				"failed to insert train with location code: %s key: %s",
+				train.LocationCode, train.PredictionKey,
+			), err)
+		}
+	}
+	return nil
+}
+
+// StoreSnapshot is an EventBus Handler that writes the snapshot's
+// predictions to DDB. A poll that reached WMATA but found no trains, as
+// happens overnight, is stored as nothing.
+func (r *Repository) StoreSnapshot(
+	ctx context.Context, event PredictionSnapshot,
+) error {
+	if len(event.Locations) == 0 && len(event.Errors) > 0 {
+		return nil
+	}
+	if len(event.Locations) > 0 {
+		if err := r.InsertTrains(ctx, event.Trains()); err != nil {
+			return fmt.Errorf("failed to insert trains into DDB: %w", err)
 		}
 	}
+	r.lastStoredMs.Store(event.Timestamp.UnixMilli())
+	r.metrics.SnapshotStored(event.Timestamp)
 	return nil
 }
 
+// LastStored is the timestamp of the last snapshot written to DDB, empty
+// ones included, false until one has been.
+func (r *Repository) LastStored() (time.Time, bool) {
+	storedMs := r.lastStoredMs.Load()
+	if storedMs == 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(storedMs), true
+}
+
 // Line -> Location -> Direction
-func GetTrainPredictions(
-	ctx context.Context, client *dynamodb.Client, request GetNextTrainsRequest,
+func (r *Repository) GetTrainPredictions(
+	ctx context.Context, request GetNextTrainsRequest,
 ) ([]TrainModel, error) {
 	validMinutes := -10 * time.Minute
 	timeRange := time.Now().Add(validMinutes).UnixMilli()
 
 	keyExpr := expression.Key("locationCode").
 		Equal(expression.Value(request.LocationCode)).
-		And(expression.Key("createdEpochMs").
-			GreaterThanEqual(expression.Value(timeRange)))
+		And(expression.Key("predictionKey").
+			GreaterThanEqual(expression.Value(pollKey(timeRange))))
+
+	builder := expression.NewBuilder().WithKeyCondition(keyExpr)
 
-	filterExpr := expression.Name("lineCode").
-		Equal(expression.Value(request.LineCode)).
-		And(expression.Name("destination").
+	// Line and direction are optional, only filter on what was requested.
+	var conditions []expression.ConditionBuilder
+	if request.LineCode != "" {
+		conditions = append(conditions, expression.Name("lineCode").
+			Equal(expression.Value(request.LineCode)))
+	}
+	if request.Direction != "" {
+		conditions = append(conditions, expression.Name("destination").
 			Equal(expression.Value(request.Direction)))
+	}
+	switch len(conditions) {
+	case 1:
+		builder = builder.WithFilter(conditions[0])
+	case 2:
+		builder = builder.WithFilter(conditions[0].And(conditions[1]))
+	}
 
-	expr, err := expression.NewBuilder().
-		WithKeyCondition(keyExpr).
-		WithFilter(filterExpr).
-		Build()
+	expr, err := builder.Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build ddb expression %w", err)
 	}
 
 	// Perform the query
-	result, err := client.Query(ctx, &dynamodb.QueryInput{
-		TableName:                 config.TrainTableName,
+	result, err := r.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 r.tableName,
 		KeyConditionExpression:    expr.KeyCondition(),
 		FilterExpression:          expr.Filter(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query trains: %w", err)
+		return nil, apperror.Store("failed to query trains", err)
 	}
 
-	log.WithField("result_len", len(result.Items)).Info("trains found.")
+	r.log.WithContext(ctx).WithField("result_len", len(result.Items)).Info("trains found.")
 
 	// Convert results to TrainModels
 	trains := make([]TrainModel, len(result.Items))
 	for i, item := range result.Items {
-		trains[i] = itemToDdbTrain(item)
+		trains[i], err = itemToDdbTrain(item)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return trains, nil
 }
 
-func itemToDdbTrain(item map[string]types.AttributeValue) TrainModel {
-	carCount, _ := strconv.Atoi(item["carCount"].(*types.AttributeValueMemberN).Value)
-	minutes, _ := strconv.Atoi(item["minutes"].(*types.AttributeValueMemberN).Value)
-	createdEpochMs, _ := strconv.Atoi(item["createdEpochMs"].(*types.AttributeValueMemberN).Value)
-	return TrainModel{
-		CarCount:        int8(carCount),
-		Destination:     item["destination"].(*types.AttributeValueMemberS).Value,
-		DestinationCode: item["destinationCode"].(*types.AttributeValueMemberS).Value,
-		DestinationName: item["destinationName"].(*types.AttributeValueMemberS).Value,
-		Group:           item["group"].(*types.AttributeValueMemberS).Value,
-		LineCode:        item["lineCode"].(*types.AttributeValueMemberS).Value,
-		LocationCode:    item["locationCode"].(*types.AttributeValueMemberS).Value,
-		LocationName:    item["locationName"].(*types.AttributeValueMemberS).Value,
-		Minutes:         int8(minutes),
-		CreatedEpochMs:  int64(createdEpochMs),
+func itemToDdbTrain(item map[string]types.AttributeValue) (TrainModel, error) {
+	var train TrainModel
+	if err := attributevalue.UnmarshalMap(item, &train); err != nil {
+		return TrainModel{}, fmt.Errorf("failed to decode train: %w", err)
 	}
+	return train, nil
 }
@@ -0,0 +1,143 @@
+package train
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestTrainItemRoundTrip(t *testing.T) {
+	want := TrainModel{
+		CarCount:        8,
+		Destination:     "Glenmont",
+		DestinationCode: "B11",
+		DestinationName: "Glenmont",
+		Group:           "1",
+		LineCode:        "RD",
+		LocationCode:    "A01",
+		LocationName:    "Metro Center",
+		Minutes:         -1,
+		CreatedEpochMs:  1718000000123,
+		PredictionKey:   "1718000000123#1#000",
+	}
+	item, err := attributevalue.MarshalMap(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := itemToDdbTrain(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("round trip changed the train:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTrainItemDecodingReportsBadAttributes(t *testing.T) {
+	_, err := itemToDdbTrain(map[string]types.AttributeValue{
+		"locationCode": &types.AttributeValueMemberS{Value: "A01"},
+		"carCount":     &types.AttributeValueMemberS{Value: "eight"},
+	})
+	if err == nil {
+		t.Error("expected an error for a mistyped attribute")
+	}
+
+	got, err := itemToDdbTrain(map[string]types.AttributeValue{
+		"locationCode":    &types.AttributeValueMemberS{Value: "A01"},
+		"destinationCode": &types.AttributeValueMemberNULL{Value: true},
+	})
+	if err != nil || got.LocationCode != "A01" || got.DestinationCode != "" {
+		t.Errorf("expected a partial train, got %+v %v", got, err)
+	}
+}
+
+func TestTrainsAtOneStationKeepDistinctKeys(t *testing.T) {
+	polled := time.UnixMilli(1718000000123)
+	list := trainList{TrainPredictions: []train{
+		{LocationCode: "A01", Group: "1", Line: "RD", Min: "2"},
+		{LocationCode: "A01", Group: "1", Line: "RD", Min: "9"},
+		{LocationCode: "A01", Group: "2", Line: "RD", Min: "4"},
+		{LocationCode: "C01", Group: "1", Line: "BL", Min: "BRD"},
+	}}
+
+	// DDB keeps one item per key, so every prediction needs its own.
+	stored := make(map[[2]string]TrainModel)
+	for _, want := range list.toTrainModels(polled) {
+		if want.CreatedEpochMs != polled.UnixMilli() {
+			t.Errorf("expected the poll time on every train, got %d", want.CreatedEpochMs)
+		}
+		item, err := attributevalue.MarshalMap(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := itemToDdbTrain(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored[[2]string{got.LocationCode, got.PredictionKey}] = got
+	}
+
+	if len(stored) != len(list.TrainPredictions) {
+		t.Fatalf("expected %d stored trains, got %+v", len(list.TrainPredictions), stored)
+	}
+	for _, key := range [][2]string{
+		{"A01", "1718000000123#1#000"},
+		{"A01", "1718000000123#1#001"},
+		{"A01", "1718000000123#2#000"},
+		{"C01", "1718000000123#1#000"},
+	} {
+		if _, ok := stored[key]; !ok {
+			t.Errorf("expected a train keyed %v in %+v", key, stored)
+		}
+	}
+	if polled, err := PollTime("1718000000123#2#000"); err != nil ||
+		polled.UnixMilli() != 1718000000123 {
+		t.Errorf("expected the poll time back from the key, got %s %v", polled, err)
+	}
+	if _, err := PollTime("A01"); err == nil {
+		t.Error("expected an error for a key without a poll time")
+	}
+	if pollKey(1718000000123) > "1718000000123#1#000" ||
+		pollKey(999) > "1718000000123#1#000" {
+		t.Error("expected poll keys to sort before the predictions they precede")
+	}
+}
+
+func TestStoreSnapshotCountsEmptyPolls(t *testing.T) {
+	r := &Repository{}
+	failed := PredictionSnapshot{
+		Timestamp: time.UnixMilli(1000),
+		Errors:    []error{errors.New("WMATA is down")},
+	}
+	if err := r.StoreSnapshot(context.Background(), failed); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.LastStored(); ok {
+		t.Error("expected a failed poll not to count as stored")
+	}
+
+	// Overnight WMATA answers with no trains.
+	empty := PredictionSnapshot{Timestamp: time.UnixMilli(2000)}
+	if err := r.StoreSnapshot(context.Background(), empty); err != nil {
+		t.Fatal(err)
+	}
+	if last, ok := r.LastStored(); !ok || last.UnixMilli() != 2000 {
+		t.Errorf("expected the empty poll to count as stored, got %s %v", last, ok)
+	}
+}
+
+func TestParseMinutesKeepsUnknownEstimatesApart(t *testing.T) {
+	for min, want := range map[string]int8{
+		"7": 7, "0": 0, "ARR": 0, "BRD": 0,
+		"---": UnknownMinutes, "": UnknownMinutes, "999": UnknownMinutes,
+	} {
+		if got := parseMinutes(min); got != want {
+			t.Errorf("parseMinutes(%q) = %d, want %d", min, got, want)
+		}
+	}
+}